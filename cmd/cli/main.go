@@ -1,11 +1,18 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
+	"os"
+	"os/signal"
 	"path/filepath"
+	"time"
 
+	"github.com/mattesthaut/gdfs/cmd/internal/logging"
 	"github.com/mattesthaut/gdfs/core"
 	"github.com/mattesthaut/gdfs/data"
 )
@@ -16,54 +23,112 @@ func main() {
 	nodeAddr := flag.String("addr", "127.0.0.1:42042", "Node address")
 	file := flag.String("file", "", "Filepath")
 	fileId := flag.String("id", "", "File id")
+	networkId := flag.String("network", core.DefaultNetworkId, "Network id")
+	timeout := flag.Duration("timeout", 0, "Maximum duration of the command (default none)")
+	logFlags := logging.RegisterFlags("warn")
 	flag.Parse()
 
+	logger, logOpts, err := logFlags.Logger(os.Stderr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	if (*isStoreReq && *isFindReq) || !(*isStoreReq || *isFindReq) {
-		log.Fatal("Bad command")
+		fatal(logger, "Bad command", nil)
+	}
+
+	// Ctrl-C interrompt les requêtes en cours.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
 	}
 
 	storage := core.NewFakeStorage()
 
-	host := core.NewHost("", storage)
+	opts := append([]core.Option{core.WithNetworkId(*networkId)}, logOpts...)
+	host := core.NewHost("", storage, opts...)
 
-	if err := host.Bootstrap(*nodeAddr); err != nil {
-		log.Fatal(err)
+	if err := host.BootstrapContext(ctx, *nodeAddr); err != nil {
+		fatal(logger, "Failed to bootstrap", err)
 	}
 
 	if *isStoreReq {
 		filePath, err := filepath.Abs(*file)
 		if err != nil {
-			log.Fatal(err)
+			fatal(logger, "Invalid file path", err)
 		}
 
 		file, err := data.ReadFile(filePath)
 		if err != nil {
-			log.Fatal(err)
+			fatal(logger, "Failed to read the file", err)
 		}
 
-		id, replicaCount := data.StoreData(file, host)
+		id, replicaCount, err := data.Publish(ctx, file, host)
+		if err != nil {
+			fatal(logger, describeError(err), err)
+		}
 		fmt.Printf("%s  (%d replicas)", id, replicaCount)
 	} else {
 
 		id, err := core.IdFromString(*fileId)
 		if err != nil {
-			log.Fatal(err)
+			fatal(logger, "Invalid file id", err)
 		}
 
 		filePath, err := filepath.Abs(*file)
 		if err != nil {
-			log.Fatal(err)
+			fatal(logger, "Invalid file path", err)
 		}
 
-		fileData, found := data.FindData(id, host)
-		if !found {
-			log.Fatal("File not found")
+		fileData, err := data.Retrieve(ctx, id, host)
+		if err != nil {
+			fatal(logger, describeError(err), err)
 		}
 
 		if err := data.WriteFile(filePath, fileData); err != nil {
-			log.Fatal(err)
+			fatal(logger, "Failed to write the file", err)
 		}
 
 		fmt.Printf("%d bytes written to %s", len(fileData), *file)
 	}
 }
+
+// Retourne un message expliquant l'échec d'une commande.
+func describeError(err error) string {
+	var partial *data.PartialTreeError
+	var replicas *core.InsufficientReplicasError
+	var busy *core.BusyError
+
+	switch {
+	case errors.Is(err, core.ErrTimeout):
+		return "Timed out"
+	case errors.Is(err, context.Canceled):
+		return "Interrupted"
+	case errors.Is(err, core.ErrNoPeers):
+		return "No peer reachable"
+	case errors.Is(err, core.ErrNotFound):
+		return "File not found"
+	case errors.As(err, &partial):
+		return fmt.Sprintf("File incomplete: %d chunks missing", len(partial.Missing))
+	case errors.As(err, &replicas):
+		return fmt.Sprintf("Chunk %s stored on %d nodes, %d required", replicas.Id, replicas.Replicas, replicas.Required)
+	case errors.As(err, &busy):
+		return fmt.Sprintf("Node %s busy, retry in %s", busy.Addr, busy.RetryAfter.Round(time.Millisecond))
+	default:
+		return err.Error()
+	}
+}
+
+// Journalise l'échec de la commande et termine le programme.
+func fatal(logger *slog.Logger, msg string, err error) {
+	if err != nil {
+		logger.Error(msg, "err", err)
+	} else {
+		logger.Error(msg)
+	}
+	os.Exit(1)
+}
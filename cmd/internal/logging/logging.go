@@ -0,0 +1,125 @@
+// Le package logging déclare les options de journalisation communes aux
+// commandes.
+package logging
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/mattesthaut/gdfs/core"
+)
+
+// Flags contient les options de journalisation d'une commande.
+type Flags struct {
+	level  *string
+	format *string
+}
+
+// Déclare les options -log-level et -log-format. defaultLevel est le
+// niveau utilisé si -log-level n'est pas précisé.
+func RegisterFlags(defaultLevel string) *Flags {
+	return &Flags{
+		level: flag.String("log-level", defaultLevel,
+			"Log level (debug, info, warn or error), optionally followed by component levels, e.g. info,rpc=debug"),
+		format: flag.String("log-format", "text", "Log format (text or json)"),
+	}
+}
+
+// Crée le journal décrit par les options, écrit sur w, et les options
+// du noeud donnant leur niveau à ses composants.
+func (f *Flags) Logger(w io.Writer) (*slog.Logger, []core.Option, error) {
+	level, components, err := parseLevels(*f.level)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Le Handler accepte le plus bas des niveaux, chaque composant est
+	// ensuite filtré selon son propre niveau.
+	minLevel := level
+	for _, l := range components {
+		minLevel = min(minLevel, l)
+	}
+
+	opts := &slog.HandlerOptions{Level: minLevel}
+
+	var handler slog.Handler
+	switch *f.format {
+	case "text":
+		handler = slog.NewTextHandler(w, opts)
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, nil, fmt.Errorf("unknown log format %q", *f.format)
+	}
+
+	logger := slog.New(handler)
+	hostOpts := []core.Option{core.WithLogger(logger)}
+
+	for _, component := range core.LogComponents {
+		l, ok := components[component]
+		if !ok {
+			l = level
+		}
+		hostOpts = append(hostOpts, core.WithLogLevel(component, l))
+	}
+
+	return slog.New(levelFilter{Handler: handler, level: level}), hostOpts, nil
+}
+
+// Analyse un niveau suivi de niveaux par composant, par exemple
+// "info,rpc=debug,storage=warn".
+func parseLevels(spec string) (slog.Level, map[string]slog.Level, error) {
+	parts := strings.Split(spec, ",")
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(parts[0])); err != nil {
+		return 0, nil, fmt.Errorf("invalid log level %q", parts[0])
+	}
+
+	components := make(map[string]slog.Level)
+	for _, part := range parts[1:] {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return 0, nil, fmt.Errorf("invalid component log level %q", part)
+		}
+
+		known := false
+		for _, component := range core.LogComponents {
+			known = known || component == name
+		}
+		if !known {
+			return 0, nil, fmt.Errorf("unknown log component %q (expected one of %s)", name, strings.Join(core.LogComponents, ", "))
+		}
+
+		var l slog.Level
+		if err := l.UnmarshalText([]byte(value)); err != nil {
+			return 0, nil, fmt.Errorf("invalid log level %q for %s", value, name)
+		}
+		components[name] = l
+	}
+
+	return level, components, nil
+}
+
+// levelFilter ignore les enregistrements de la commande sous son niveau,
+// le Handler acceptant les niveaux plus bas des composants du noeud.
+type levelFilter struct {
+	slog.Handler
+	level slog.Level
+}
+
+func (f levelFilter) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= f.level && f.Handler.Enabled(ctx, level)
+}
+
+func (f levelFilter) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return levelFilter{Handler: f.Handler.WithAttrs(attrs), level: f.level}
+}
+
+func (f levelFilter) WithGroup(name string) slog.Handler {
+	return levelFilter{Handler: f.Handler.WithGroup(name), level: f.level}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"net"
+)
+
+// Valeur de -advertise demandant l'adresse au noeud d'amorçage.
+const autoAdvertisedAddr = "auto"
+
+// Vérifie que les autres noeuds pourront joindre le noeud à l'adresse
+// qu'il annonce.
+func checkAdvertisedAddr(listenAddr, advertisedAddr, bootstrapAddr string) error {
+	host, _, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		return err
+	}
+
+	switch advertisedAddr {
+	case "":
+		if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+			return errors.New("-advertise is required when listening on all interfaces")
+		}
+	case autoAdvertisedAddr:
+		if bootstrapAddr == "" {
+			return errors.New("-advertise auto requires -bootstrap")
+		}
+	default:
+		if _, _, err := net.SplitHostPort(advertisedAddr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestCheckAdvertisedAddr(t *testing.T) {
+	for _, c := range []struct {
+		listen, advertised, bootstrap string
+		valid                         bool
+	}{
+		{"127.0.0.1:42042", "", "", true},
+		{"0.0.0.0:42042", "", "", false},
+		{":42042", "", "", false},
+		{"0.0.0.0:42042", "203.0.113.1:42042", "", true},
+		{"0.0.0.0:42042", "203.0.113.1", "", false},
+		{"0.0.0.0:42042", autoAdvertisedAddr, "", false},
+		{"0.0.0.0:42042", autoAdvertisedAddr, "203.0.113.2:42042", true},
+	} {
+		err := checkAdvertisedAddr(c.listen, c.advertised, c.bootstrap)
+		if (err == nil) != c.valid {
+			t.Fatalf("-listen %q -advertise %q -bootstrap %q: %v", c.listen, c.advertised, c.bootstrap, err)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/mattesthaut/gdfs/core"
+)
+
+// Déclare les options modifiant la configuration du noeud. Les valeurs
+// par défaut sont celles de config.
+func configFlags(config *core.Config) {
+	flag.IntVar(&config.BatchSize, "batch-size", config.BatchSize, "Number of peers queried concurrently by lookups")
+	flag.IntVar(&config.MaxReplicasCount, "replicas", config.MaxReplicasCount, "Maximum number of replicas of a value")
+	flag.IntVar(&config.MinReplicasCount, "min-replicas", config.MinReplicasCount, "Number of replicas below which a store fails")
+	flag.IntVar(&config.BucketCapacity, "bucket-capacity", config.BucketCapacity, "Maximum number of peers per bucket")
+	flag.DurationVar(&config.StorageTtl, "storage-ttl", config.StorageTtl, "Lifetime of a stored value")
+	flag.IntVar(&config.StorageCapacity, "storage-capacity", config.StorageCapacity, "Maximum number of stored values")
+	flag.DurationVar(&config.ConnTtl, "conn-ttl", config.ConnTtl, "Maximum time to wait for a response")
+	flag.DurationVar(&config.CleanupFreq, "cleanup-freq", config.CleanupFreq, "Routing table cleanup frequency")
+	flag.DurationVar(&config.RefreshFreq, "refresh-freq", config.RefreshFreq, "Time without lookup before a bucket is refreshed")
+	flag.DurationVar(&config.ReplicateFreq, "replicate-freq", config.ReplicateFreq, "Republishing frequency of stored values")
+	flag.DurationVar(&config.RepublishFreq, "republish-freq", config.RepublishFreq, "Republishing frequency of published values")
+	flag.DurationVar(&config.PublishedTtl, "published-ttl", config.PublishedTtl, "Time during which a published value is republished")
+	flag.IntVar(&config.MaxPublished, "max-published", config.MaxPublished, "Maximum number of republished values")
+	flag.IntVar(&config.MaxInboundConns, "max-inbound-conns", config.MaxInboundConns, "Maximum number of concurrent inbound connections")
+	flag.Float64Var(&config.PeerStoreLimit.Rate, "peer-store-rate", config.PeerStoreLimit.Rate, "Stores per second accepted from a peer")
+	flag.Float64Var(&config.PeerLookupLimit.Rate, "peer-lookup-rate", config.PeerLookupLimit.Rate, "Lookups per second accepted from a peer")
+	flag.Float64Var(&config.IpStoreLimit.Rate, "ip-store-rate", config.IpStoreLimit.Rate, "Stores per second accepted from an IP address")
+	flag.Float64Var(&config.IpLookupLimit.Rate, "ip-lookup-rate", config.IpLookupLimit.Rate, "Lookups per second accepted from an IP address")
+	flag.BoolVar(&config.ExemptLocalAddrs, "exempt-local-addrs", config.ExemptLocalAddrs, "Do not rate limit loopback addresses by IP")
+	flag.IntVar(&config.RequestWorkers, "request-workers", config.RequestWorkers, "Number of inbound requests handled concurrently")
+	flag.IntVar(&config.RequestQueueSize, "request-queue-size", config.RequestQueueSize, "Maximum number of queued inbound requests per priority")
+	flag.BoolVar(&config.AllowInsecure, "allow-insecure", config.AllowInsecure, "Accept peers that do not encrypt their connections")
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	keyFileName = "key.pem"
+	// Fichier où les versions précédentes enregistraient un identifiant
+	// aléatoire, qui ne peut pas être dérivé d'une clé.
+	idFileName = "id"
+)
+
+// Charge la clé du noeud depuis le répertoire de données. Si elle
+// n'existe pas, une nouvelle clé est créée et enregistrée. L'identifiant
+// du noeud est dérivé de cette clé. Un répertoire contenant l'identifiant
+// d'une version précédente est refusé plutôt que de changer
+// silencieusement l'identifiant du noeud.
+func loadOrCreateKey(dataDir string) (ed25519.PrivateKey, error) {
+	path := filepath.Join(dataDir, keyFileName)
+
+	content, err := os.ReadFile(path)
+	if err == nil {
+		return parseKey(path, content)
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	idPath := filepath.Join(dataDir, idFileName)
+	if _, err := os.Stat(idPath); err == nil {
+		return nil, fmt.Errorf(
+			"%s contains a node id from a previous version, which cannot be kept since ids are now derived from a key: remove it to start with a new id",
+			idPath,
+		)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dataDir, 0o700); err != nil {
+		return nil, err
+	}
+
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	block := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(path, block, 0o600); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func parseKey(path string, content []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(content)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("invalid node key in %s", path)
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("node key in %s is not an Ed25519 key", path)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattesthaut/gdfs/core"
+)
+
+func TestIdentityPersistence(t *testing.T) {
+	dataDir := filepath.Join(t.TempDir(), "node")
+
+	key, err := loadOrCreateKey(dataDir)
+	if err != nil {
+		t.Fatalf("Erreur lors de la création de la clé: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(dataDir, keyFileName))
+	if err != nil {
+		t.Fatalf("La clé n'a pas été enregistrée: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("La clé est lisible par d'autres utilisateurs: %v", info.Mode().Perm())
+	}
+
+	loaded, err := loadOrCreateKey(dataDir)
+	if err != nil {
+		t.Fatalf("Erreur lors du chargement de la clé: %v", err)
+	}
+	if !key.Equal(loaded) {
+		t.Fatal("La clé chargée ne correspond pas à la clé enregistrée")
+	}
+
+	before := core.NewHostWithKey(key, "node-a", core.NewMemoryStorage())
+	after := core.NewHostWithKey(loaded, "node-a", core.NewMemoryStorage())
+	if !before.Id().Equal(after.Id()) {
+		t.Fatal("Le noeud aurait dû conserver son identifiant après un redémarrage")
+	}
+}
+
+func TestInvalidIdentity(t *testing.T) {
+	dataDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dataDir, keyFileName), []byte("invalid"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := loadOrCreateKey(dataDir); err == nil {
+		t.Fatal("Une clé invalide aurait dû être refusée plutôt que remplacée")
+	}
+}
+
+func TestPreviousIdentity(t *testing.T) {
+	dataDir := t.TempDir()
+	id := core.NewRandomId()
+	if err := os.WriteFile(filepath.Join(dataDir, idFileName), []byte(id.String()+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := loadOrCreateKey(dataDir); err == nil {
+		t.Fatal("L'identifiant d'une version précédente aurait dû être signalé plutôt que remplacé")
+	}
+
+	if _, err := os.Stat(filepath.Join(dataDir, keyFileName)); !os.IsNotExist(err) {
+		t.Fatal("Aucune clé n'aurait dû être créée")
+	}
+}
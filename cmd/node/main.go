@@ -1,49 +1,155 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/mattesthaut/gdfs/cmd/internal/logging"
 	"github.com/mattesthaut/gdfs/core"
 )
 
 func main() {
 	port := flag.Int("port", 42042, "DFS node port")
+	listenAddr := flag.String("listen", "", "Listen address (default 127.0.0.1:{port})")
+	advertisedAddr := flag.String("advertise", "", "Address advertised to other nodes, or \"auto\" to ask the bootstrap node (default listen address)")
 	bootstrapAddr := flag.String("bootstrap", "", "Bootstrap address")
-	flag.Parse()
+	useUDP := flag.Bool("udp", false, "Use UDP for lightweight requests")
+	networkId := flag.String("network", core.DefaultNetworkId, "Network id")
+	dataDir := flag.String("data", "", "Data directory (default gdfs-{port})")
+	metricsAddr := flag.String("metrics", "", "Address of the Prometheus metrics endpoint (default disabled)")
+	drainTimeout := flag.Duration("drain-timeout", 30*time.Second, "Maximum time to hand off values and leave the network on SIGTERM")
 
-	storage := core.NewMemoryStorage()
+	logFlags := logging.RegisterFlags("info")
 
-	nodeAddr := fmt.Sprintf("127.0.0.1:%d", *port)
-	host := core.NewHost(nodeAddr, storage)
+	config := core.DefaultConfig()
+	configFlags(&config)
+	flag.Parse()
 
-	if err := host.Start(); err != nil {
+	logger, logOpts, err := logFlags.Logger(os.Stderr)
+	if err != nil {
 		log.Fatal(err)
 	}
 
+	if err := config.Validate(); err != nil {
+		fatal(logger, "invalid configuration", err)
+	}
+
+	if *dataDir == "" {
+		*dataDir = fmt.Sprintf("gdfs-%d", *port)
+	}
+
+	if *listenAddr == "" {
+		*listenAddr = fmt.Sprintf("127.0.0.1:%d", *port)
+	}
+
+	if err := checkAdvertisedAddr(*listenAddr, *advertisedAddr, *bootstrapAddr); err != nil {
+		fatal(logger, "invalid advertised address", err)
+	}
+
+	key, err := loadOrCreateKey(*dataDir)
+	if err != nil {
+		fatal(logger, "failed to load the node key", err)
+	}
+
+	storage := core.NewMemoryStorageWithConfig(config)
+
+	var transport core.Transport = core.NewTCPTransport()
+	if *useUDP {
+		transport = core.NewUDPTransport()
+	}
+
+	opts := []core.Option{
+		core.WithTransport(transport),
+		core.WithNetworkId(*networkId),
+		core.WithConfig(config),
+	}
+	opts = append(opts, logOpts...)
+
+	switch *advertisedAddr {
+	case "":
+	case autoAdvertisedAddr:
+		opts = append(opts, core.WithAddrDiscovery())
+	default:
+		opts = append(opts, core.WithAdvertisedAddr(*advertisedAddr))
+	}
+
+	host := core.NewHostWithKey(key, *listenAddr, storage, opts...)
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	runCtx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- host.Run(runCtx)
+	}()
+
+	select {
+	case <-host.Ready():
+	case err := <-stopped:
+		fatal(logger, "failed to start the node", err)
+	}
+
+	if *metricsAddr != "" {
+		serveMetrics(*metricsAddr, host, logger)
+		logger.Info("serving metrics", "url", fmt.Sprintf("http://%s/metrics", *metricsAddr))
+	}
+
 	if *bootstrapAddr != "" {
 		if err := host.Bootstrap(*bootstrapAddr); err != nil {
-			log.Fatal(err)
+			fatal(logger, "failed to bootstrap", err)
 		}
 	}
 
 	go func() {
 		for {
 			time.Sleep(60 * time.Second)
-			peerCount := host.KnownPeerCount()
-			log.Printf("%d node in routing table", peerCount)
-			log.Printf("%d value in storage", storage.Len())
+			logger.Info("status", "peers", host.KnownPeerCount(), "values", storage.Len())
 		}
 	}()
 
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	// SIGTERM quitte le réseau en transmettant les valeurs détenues, un
+	// autre signal arrête le noeud aussitôt.
+	var sig os.Signal
+	select {
+	case sig = <-sigChan:
+	case err := <-stopped:
+		fatal(logger, "node stopped", err)
+	}
+
+	if sig != syscall.SIGTERM {
+		stop()
+		<-stopped
+		return
+	}
+
+	logger.Info("leaving the network", "timeout", *drainTimeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *drainTimeout)
+	defer cancel()
+
+	go func() {
+		<-sigChan
+		cancel()
+	}()
+
+	if err := host.Leave(ctx); err != nil {
+		logger.Warn("left the network before handing off every value", "err", err)
+	}
+	<-stopped
+}
 
-	<-sigChan
-	host.Stop()
+// Journalise une erreur fatale et termine le programme.
+func fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, "err", err)
+	os.Exit(1)
 }
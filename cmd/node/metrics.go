@@ -0,0 +1,26 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/mattesthaut/gdfs/core"
+)
+
+// Sert les métriques du noeud au format texte de Prometheus sur
+// http://{addr}/metrics.
+func serveMetrics(addr string, host *core.Host, logger *slog.Logger) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := host.WriteMetrics(w); err != nil {
+			logger.Warn("failed to write metrics", "err", err)
+		}
+	})
+
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			fatal(logger, "failed to serve metrics", err)
+		}
+	}()
+}
@@ -0,0 +1,195 @@
+package core
+
+import (
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+// Version du protocole à partir de laquelle un noeud surchargé répond
+// aux requêtes qu'il refuse par une réponse busy.
+const busyVersion = 5
+
+// tokenBucket est le seau à jetons d'une clé.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time // dernière mise à jour de tokens
+}
+
+// rateLimiter limite le débit de requêtes par clé, avec un seau à jetons
+// par clé. rateLimiter est sûr pour une utilisation concurrente.
+type rateLimiter struct {
+	limit   RateLimit
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func newRateLimiter(limit RateLimit) *rateLimiter {
+	return &rateLimiter{
+		limit:   limit,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// Consomme un jeton de la clé. S'il n'y en a pas, retourne false et le
+// délai avant qu'un jeton soit disponible.
+func (l *rateLimiter) allow(key string, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(l.limit.Burst), last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = min(float64(l.limit.Burst), b.tokens+now.Sub(b.last).Seconds()*l.limit.Rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+
+	wait := (1 - b.tokens) / l.limit.Rate
+	return time.Duration(math.Ceil(wait * float64(time.Second))), false
+}
+
+// Oublie les clés dont le seau s'est rempli depuis, qui se comportent
+// comme des clés inconnues.
+func (l *rateLimiter) prune(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.limit.Rate >= float64(l.limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// admission limite les requêtes reçues par un Host : le nombre de
+// connexions entrantes simultanées, et le débit des stockages et des
+// recherches par adresse IP et par émetteur.
+type admission struct {
+	inbound chan struct{} // un jeton par connexion entrante, créé par listen
+
+	peerStores  *rateLimiter
+	peerLookups *rateLimiter
+	ipStores    *rateLimiter
+	ipLookups   *rateLimiter
+	exemptLocal bool // voir Config.ExemptLocalAddrs
+}
+
+func newAdmission(config Config) admission {
+	return admission{
+		peerStores:  newRateLimiter(config.PeerStoreLimit),
+		peerLookups: newRateLimiter(config.PeerLookupLimit),
+		ipStores:    newRateLimiter(config.IpStoreLimit),
+		ipLookups:   newRateLimiter(config.IpLookupLimit),
+		exemptLocal: config.ExemptLocalAddrs,
+	}
+}
+
+// Vérifie le débit des requêtes de l'adresse IP observée, ou de
+// l'adresse observée si elle n'a pas d'IP. Les adresses de boucle locale
+// et les transports sans IP ne sont pas limités si exemptLocal est vrai.
+func (a *admission) allowIp(observed net.Addr, reqType int) (time.Duration, bool) {
+	key := "addr:" + observed.String()
+	ip := observedIp(observed)
+	if ip != nil {
+		key = "ip:" + ip.String()
+	}
+
+	if a.exemptLocal && (ip == nil || ip.IsLoopback()) {
+		return 0, true
+	}
+
+	if reqType == StoreRequestType {
+		return a.ipStores.allow(key, time.Now())
+	}
+	return a.ipLookups.allow(key, time.Now())
+}
+
+// Vérifie le débit des requêtes d'un émetteur ayant prouvé son identité.
+func (a *admission) allowPeer(id Id, reqType int) (time.Duration, bool) {
+	if reqType == StoreRequestType {
+		return a.peerStores.allow(string(id[:]), time.Now())
+	}
+	return a.peerLookups.allow(string(id[:]), time.Now())
+}
+
+// Vérifie le débit des requêtes non signées de l'adresse observée avec
+// les limites par émetteur : sans signature, l'émetteur est identifié
+// par son adresse IP, ou par l'adresse observée si elle n'a pas d'IP.
+// Un émetteur ne peut donc pas échapper aux limites par émetteur en ne
+// signant pas ses requêtes.
+func (a *admission) allowUnsigned(observed net.Addr, reqType int) (time.Duration, bool) {
+	key := "addr:" + observed.String()
+	if ip := observedIp(observed); ip != nil {
+		key = "ip:" + ip.String()
+	}
+
+	if reqType == StoreRequestType {
+		return a.peerStores.allow(key, time.Now())
+	}
+	return a.peerLookups.allow(key, time.Now())
+}
+
+func (a *admission) prune() {
+	now := time.Now()
+	for _, l := range []*rateLimiter{a.peerStores, a.peerLookups, a.ipStores, a.ipLookups} {
+		l.prune(now)
+	}
+}
+
+// Retourne la réponse à une requête refusée car le noeud est surchargé.
+func busyResponse(req Request, retryAfter time.Duration) Response {
+	return Response{
+		Type:       req.Type,
+		Busy:       true,
+		RetryAfter: retryAfter,
+	}
+}
+
+// Indique si les requêtes vers le noeud[addr] sont suspendues après une
+// réponse busy, et pour combien de temps.
+func (h *Host) backingOff(addr string) (time.Duration, bool) {
+	h.busyMu.Lock()
+	defer h.busyMu.Unlock()
+
+	until, ok := h.busy[addr]
+	if !ok {
+		return 0, false
+	}
+
+	wait := time.Until(until)
+	if wait <= 0 {
+		delete(h.busy, addr)
+		return 0, false
+	}
+
+	return wait, true
+}
+
+// Suspend les requêtes vers le noeud[addr] pendant retryAfter.
+func (h *Host) backOff(addr string, retryAfter time.Duration) {
+	h.busyMu.Lock()
+	defer h.busyMu.Unlock()
+
+	h.busy[addr] = time.Now().Add(retryAfter)
+}
+
+// Oublie les noeuds dont la suspension a pris fin.
+func (h *Host) pruneBusy() {
+	h.busyMu.Lock()
+	defer h.busyMu.Unlock()
+
+	now := time.Now()
+	for addr, until := range h.busy {
+		if now.After(until) {
+			delete(h.busy, addr)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestBusyBackoffCap(t *testing.T) {
+	transport := NewMemoryTransport()
+
+	config := DefaultConfig()
+	config.PeerStoreLimit = RateLimit{Rate: 0.001, Burst: 1}
+
+	a := NewHost("node-a", NewMemoryStorage(), WithTransport(transport))
+	b := NewHost("node-b", NewMemoryStorage(), WithTransport(transport), WithConfig(config))
+
+	for _, host := range []*Host{a, b} {
+		if err := host.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer host.Stop()
+	}
+
+	peer := Peer{Id: b.id, Addr: b.Addr()}
+	a.storeTo(context.Background(), peer, Id{1}, Value{1})
+
+	// Le noeud demande d'attendre environ 1000 secondes.
+	_, err := a.storeTo(context.Background(), peer, Id{2}, Value{2})
+
+	var busy *BusyError
+	if !errors.As(err, &busy) || busy.RetryAfter > maxBusyBackoff {
+		t.Fatalf("Le délai demandé aurait dû être limité à %s: %v", maxBusyBackoff, err)
+	}
+
+	if wait, ok := a.backingOff(b.Addr()); !ok || wait > maxBusyBackoff {
+		t.Fatalf("Les requêtes auraient dû être suspendues au plus %s: %s", maxBusyBackoff, wait)
+	}
+}
+
+func TestUnauthenticatedBusy(t *testing.T) {
+	transport := NewMemoryTransport()
+	listener, err := transport.Listen("node-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// Un noeud répondant busy sur une connexion non chiffrée.
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		codec := codecFor(ProtocolVersion)
+		for {
+			reqId, payload, err := readFrame(conn)
+			if err != nil {
+				return
+			}
+
+			req, _ := codec.decodeRequest(payload)
+			res, _ := codec.encodeResponse(busyResponse(req, time.Hour))
+			writeFrame(conn, reqId, res)
+		}
+	}()
+
+	h := NewHost("node-a", NewMemoryStorage(), WithTransport(transport))
+	h.pool = newConnPool(transport, func(conn net.Conn) (net.Conn, session, error) {
+		return conn, session{version: ProtocolVersion, caps: localCapabilities}, nil
+	}, h.config)
+	defer h.pool.close()
+
+	_, err = h.request(context.Background(), "node-b", h.sign(newPingRequest()))
+	if !errors.Is(err, ErrPeerBusy) {
+		t.Fatalf("La requête aurait dû échouer avec une BusyError: %v", err)
+	}
+
+	if _, ok := h.backingOff("node-b"); ok {
+		t.Fatal("Une réponse busy non authentifiée n'aurait pas dû suspendre les requêtes")
+	}
+}
+
+func TestUnsignedRateLimit(t *testing.T) {
+	config := DefaultConfig()
+	config.PeerLookupLimit = RateLimit{Rate: 0.001, Burst: 1}
+
+	h := NewHost("node-a", NewMemoryStorage(), WithTransport(NewMemoryTransport()), WithConfig(config))
+	observed := &net.TCPAddr{IP: net.ParseIP("203.0.113.1"), Port: 42042}
+
+	for i, busy := range []bool{false, true} {
+		// Une requête non signée, dont l'émetteur change à chaque fois.
+		req := newFindNodeRequest(Id{1})
+		req.SenderId = NewRandomId()
+
+		_, err := h.admitReq(req, observed)
+		if errors.Is(err, ErrPeerBusy) != busy {
+			t.Fatalf("Requête non signée %d: busy %v attendu (%v)", i+1, busy, err)
+		}
+	}
+}
+
+func TestDatagramRequestIds(t *testing.T) {
+	c := &datagramConn{pending: make(map[uint64]chan []byte)}
+
+	first := c.newRequestId()
+	c.pending[first] = make(chan []byte)
+	second := c.newRequestId()
+
+	if second == first || second == first+1 {
+		t.Fatalf("Les identifiants de requête auraient dû être imprévisibles: %d, %d", first, second)
+	}
+}
+
+func TestIpRateLimit(t *testing.T) {
+	config := DefaultConfig()
+	config.IpLookupLimit = RateLimit{Rate: 0.001, Burst: 1}
+
+	local := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4000}
+	remote := &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 4000}
+
+	for _, exempt := range []bool{false, true} {
+		config.ExemptLocalAddrs = exempt
+		h := NewHost("node-a", NewMemoryStorage(), WithConfig(config))
+
+		for _, observed := range []net.Addr{local, remote, memoryAddr("node-b")} {
+			// Chaque requête vient d'un émetteur différent : seule la
+			// limite par adresse IP peut la refuser.
+			_, first := h.admitReq(NewHost("", NewMemoryStorage()).sign(newPingRequest()), observed)
+			_, second := h.admitReq(NewHost("", NewMemoryStorage()).sign(newPingRequest()), observed)
+
+			limited := !exempt || observed == remote
+			if first != nil || errors.Is(second, ErrPeerBusy) != limited {
+				t.Fatalf("La limite par IP de %s (exemption: %t) aurait dû refuser la deuxième requête: %t", observed, exempt, limited)
+			}
+		}
+	}
+}
+
+func TestFloodingSender(t *testing.T) {
+	config := DefaultConfig()
+	config.PeerLookupLimit = RateLimit{Rate: 0.001, Burst: 2}
+	config.RequestQueueSize = 4
+
+	// Sans worker, les requêtes admises restent dans la file.
+	h := NewHost("node-a", NewMemoryStorage(), WithConfig(config))
+	h.requests = newRequestQueue(config.RequestQueueSize)
+
+	flooder := NewHost("node-b", NewMemoryStorage())
+	honest := NewHost("node-c", NewMemoryStorage())
+
+	for range 2 * config.RequestQueueSize {
+		h.schedule(flooder.sign(newPingRequest()), memoryAddr("node-b"))
+	}
+
+	if queued := h.QueuedRequests(); queued != config.PeerLookupLimit.Burst {
+		t.Fatalf("Seules les requêtes admises auraient dû entrer dans la file: %d en attente", queued)
+	}
+
+	if res, _ := h.schedule(honest.sign(newPingRequest()), memoryAddr("node-c")); res.Busy {
+		t.Fatal("La requête d'un autre émetteur aurait dû entrer dans la file")
+	}
+}
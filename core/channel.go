@@ -0,0 +1,293 @@
+package core
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+)
+
+// Version du protocole à partir de laquelle les connexions sont chiffrées.
+const secureVersion = 4
+
+// Taille de l'entête d'un enregistrement chiffré : taille du contenu
+// chiffré (4 octets).
+const recordHeaderSize = 4
+
+var errChannelAuth = errors.New("channel authentication failed")
+
+// Étiquettes séparant les usages des clés et des signatures.
+const (
+	channelLabel          = "gdfs channel v1"
+	initiatorLabel        = "initiator"
+	responderLabel        = "responder"
+	clientToServerKeyInfo = "gdfs client to server"
+	serverToClientKeyInfo = "gdfs server to client"
+)
+
+// Établit un canal chiffré avec le noeud distant, du côté du noeud qui a
+// ouvert la connexion. Les deux noeuds échangent des clés X25519
+// éphémères et signent l'empreinte de la poignée de main, hellos
+// compris, avec leur clé Ed25519. Retourne la connexion chiffrée et
+// l'identifiant du noeud distant.
+//
+// client → serveur : clé éphémère
+// serveur → client : clé éphémère, clé publique, signature
+// client → serveur : clé publique, signature
+func (h *Host) secureClient(conn net.Conn, local, remote hello) (net.Conn, Id, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, Id{}, err
+	}
+
+	if _, err := conn.Write(ephemeral.PublicKey().Bytes()); err != nil {
+		return nil, Id{}, err
+	}
+
+	var msg [32 + ed25519.PublicKeySize + ed25519.SignatureSize]byte
+	if _, err := io.ReadFull(conn, msg[:]); err != nil {
+		return nil, Id{}, err
+	}
+
+	remoteEphemeral, err := ecdh.X25519().NewPublicKey(msg[:32])
+	if err != nil {
+		return nil, Id{}, err
+	}
+
+	transcript, err := channelTranscript(local, remote, ephemeral.PublicKey(), remoteEphemeral)
+	if err != nil {
+		return nil, Id{}, err
+	}
+
+	remoteKey := ed25519.PublicKey(msg[32 : 32+ed25519.PublicKeySize])
+	remoteSig := msg[32+ed25519.PublicKeySize:]
+	if !ed25519.Verify(remoteKey, append([]byte(responderLabel), transcript...), remoteSig) {
+		return nil, Id{}, errChannelAuth
+	}
+
+	reply := append([]byte{}, h.key.Public().(ed25519.PublicKey)...)
+	reply = append(reply, ed25519.Sign(h.key, append([]byte(initiatorLabel), transcript...))...)
+	if _, err := conn.Write(reply); err != nil {
+		return nil, Id{}, err
+	}
+
+	secure, err := newSecureConn(conn, ephemeral, remoteEphemeral, transcript, clientToServerKeyInfo, serverToClientKeyInfo)
+	if err != nil {
+		return nil, Id{}, err
+	}
+
+	return secure, IdFromPublicKey(remoteKey), nil
+}
+
+// Établit un canal chiffré avec le noeud distant, du côté du noeud qui a
+// accepté la connexion. Voir secureClient.
+func (h *Host) secureServer(conn net.Conn, local, remote hello) (net.Conn, Id, error) {
+	var msg [32]byte
+	if _, err := io.ReadFull(conn, msg[:]); err != nil {
+		return nil, Id{}, err
+	}
+
+	remoteEphemeral, err := ecdh.X25519().NewPublicKey(msg[:])
+	if err != nil {
+		return nil, Id{}, err
+	}
+
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, Id{}, err
+	}
+
+	transcript, err := channelTranscript(remote, local, remoteEphemeral, ephemeral.PublicKey())
+	if err != nil {
+		return nil, Id{}, err
+	}
+
+	reply := append([]byte{}, ephemeral.PublicKey().Bytes()...)
+	reply = append(reply, h.key.Public().(ed25519.PublicKey)...)
+	reply = append(reply, ed25519.Sign(h.key, append([]byte(responderLabel), transcript...))...)
+	if _, err := conn.Write(reply); err != nil {
+		return nil, Id{}, err
+	}
+
+	var auth [ed25519.PublicKeySize + ed25519.SignatureSize]byte
+	if _, err := io.ReadFull(conn, auth[:]); err != nil {
+		return nil, Id{}, err
+	}
+
+	remoteKey := ed25519.PublicKey(auth[:ed25519.PublicKeySize])
+	remoteSig := auth[ed25519.PublicKeySize:]
+	if !ed25519.Verify(remoteKey, append([]byte(initiatorLabel), transcript...), remoteSig) {
+		return nil, Id{}, errChannelAuth
+	}
+
+	secure, err := newSecureConn(conn, ephemeral, remoteEphemeral, transcript, serverToClientKeyInfo, clientToServerKeyInfo)
+	if err != nil {
+		return nil, Id{}, err
+	}
+
+	return secure, IdFromPublicKey(remoteKey), nil
+}
+
+// Retourne l'empreinte de la poignée de main. Elle couvre les hellos
+// pour qu'un intermédiaire ne puisse pas les modifier sans être détecté.
+func channelTranscript(client, server hello, clientEphemeral, serverEphemeral *ecdh.PublicKey) ([]byte, error) {
+	clientHello, err := encodeHello(client)
+	if err != nil {
+		return nil, err
+	}
+
+	serverHello, err := encodeHello(server)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.New()
+	digest.Write([]byte(channelLabel))
+	digest.Write(clientHello)
+	digest.Write(serverHello)
+	digest.Write(clientEphemeral.Bytes())
+	digest.Write(serverEphemeral.Bytes())
+
+	return digest.Sum(nil), nil
+}
+
+// secureConn chiffre et authentifie tout ce qui transite sur une
+// connexion avec AES-256-GCM. Chaque sens utilise sa propre clé et un
+// compteur comme nonce, un enregistrement rejoué, supprimé ou réordonné
+// fait échouer la lecture.
+type secureConn struct {
+	net.Conn
+
+	writeMu   sync.Mutex
+	sealer    cipher.AEAD
+	sendCount uint64
+
+	readMu    sync.Mutex
+	opener    cipher.AEAD
+	recvCount uint64
+	pending   []byte // contenu déchiffré pas encore lu
+}
+
+func newSecureConn(
+	conn net.Conn,
+	ephemeral *ecdh.PrivateKey,
+	remoteEphemeral *ecdh.PublicKey,
+	transcript []byte,
+	sendInfo, recvInfo string,
+) (*secureConn, error) {
+	secret, err := ephemeral.ECDH(remoteEphemeral)
+	if err != nil {
+		return nil, err
+	}
+
+	sealer, err := channelCipher(secret, transcript, sendInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	opener, err := channelCipher(secret, transcript, recvInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	return &secureConn{Conn: conn, sealer: sealer, opener: opener}, nil
+}
+
+func channelCipher(secret, transcript []byte, info string) (cipher.AEAD, error) {
+	key, err := hkdf.Key(sha256.New, secret, transcript, info, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func channelNonce(count uint64) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[4:], count)
+	return nonce
+}
+
+// Chiffre b par enregistrements d'au plus maxRecordSize octets.
+func (c *secureConn) Write(b []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	written := 0
+	for written < len(b) {
+		size := min(len(b)-written, maxRecordSize)
+
+		record := make([]byte, recordHeaderSize, recordHeaderSize+size+c.sealer.Overhead())
+		record = c.sealer.Seal(record, channelNonce(c.sendCount), b[written:written+size], nil)
+		binary.BigEndian.PutUint32(record[:recordHeaderSize], uint32(len(record)-recordHeaderSize))
+		c.sendCount++
+
+		if _, err := c.Conn.Write(record); err != nil {
+			return written, err
+		}
+
+		written += size
+	}
+
+	return written, nil
+}
+
+// Lit le contenu déchiffré. Un enregistrement altéré ferme la lecture
+// avec errChannelAuth.
+func (c *secureConn) Read(b []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	if len(c.pending) == 0 {
+		var header [recordHeaderSize]byte
+		if _, err := io.ReadFull(c.Conn, header[:]); err != nil {
+			return 0, err
+		}
+
+		size := binary.BigEndian.Uint32(header[:])
+		if size > uint32(maxRecordSize+c.opener.Overhead()) {
+			return 0, errFrameTooLarge
+		}
+
+		record := make([]byte, size)
+		if _, err := io.ReadFull(c.Conn, record); err != nil {
+			return 0, err
+		}
+
+		plain, err := c.opener.Open(record[:0], channelNonce(c.recvCount), record, nil)
+		if err != nil {
+			return 0, errChannelAuth
+		}
+		c.recvCount++
+		c.pending = plain
+	}
+
+	n := copy(b, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// Vérifie que la requête reçue sur une connexion chiffrée a été émise
+// par le noeud authentifié lors de la poignée de main.
+func (s session) accepts(req Request) bool {
+	return !s.secure || (req.isSigned() && req.SenderId.Equal(s.remoteId))
+}
+
+// Vérifie que la réponse reçue sur une connexion chiffrée a été signée
+// par le noeud authentifié lors de la poignée de main.
+func (s session) acceptsResponse(res Response) bool {
+	return !s.secure || IdFromPublicKey(res.PublicKey[:]).Equal(s.remoteId)
+}
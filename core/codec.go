@@ -0,0 +1,463 @@
+package core
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Un codec encode les requêtes et les réponses échangées entre les
+// noeuds. Le codec d'une connexion dépend de la version du protocole
+// convenue lors de la poignée de main.
+type codec interface {
+	encodeRequest(req Request) ([]byte, error)
+	decodeRequest(data []byte) (Request, error)
+	encodeResponse(res Response) ([]byte, error)
+	// decodeResponse décode la réponse à une requête de type reqType.
+	decodeResponse(data []byte, reqType int) (Response, error)
+}
+
+// Version du protocole à partir de laquelle binaryCodec est utilisé.
+const binaryCodecVersion = 2
+
+// Retourne le codec associé à une version du protocole. La version est
+// celle convenue lors de la poignée de main : un noeud qui n'envoie pas
+// de hello est refusé avant le choix du codec, quel que soit son format.
+func codecFor(version uint16) codec {
+	if version >= binaryCodecVersion {
+		return binaryCodec{
+			signed: version >= signedVersion,
+			busy:   version >= busyVersion,
+		}
+	}
+	return gobCodec{}
+}
+
+var errMalformedMessage = errors.New("malformed message")
+
+// binaryCodec encode les messages dans un format binaire compact. Un
+// message commence par le type de la requête (1 octet) suivi uniquement
+// des champs utiles à ce type :
+//
+//	requête : SenderId, SenderAddr, puis Id (sauf ping, observed addr
+//	          et leave), puis Value (store)
+//	réponse : Id (ping), Peers (find node), Found puis Value ou Peers
+//	          (find value), Ok (store), Addr (observed addr), rien
+//	          (leave)
+//
+// Une adresse est précédée de sa taille (1 octet), une liste de noeuds
+// de sa longueur (1 octet). Les tailles sont vérifiées lors du décodage.
+// À partir de signedVersion, une requête se termine par PublicKey,
+// Timestamp et Signature, et une réponse par PublicKey et Signature.
+// À partir de busyVersion, une réponse busy est composée de
+// busyResponseType suivi de RetryAfter en millisecondes (4 octets), et
+// n'est pas signée.
+type binaryCodec struct {
+	signed bool
+	busy   bool
+}
+
+// Type d'une réponse busy, distinct de tout type de requête.
+const busyResponseType = 0xff
+
+const (
+	maxAddrSize     = 255
+	encodedPeerSize = IdSize + 1 + maxAddrSize // taille maximale d'un noeud encodé
+
+	requestSignatureSize  = ed25519.PublicKeySize + 8 + ed25519.SignatureSize
+	responseSignatureSize = ed25519.PublicKeySize + ed25519.SignatureSize
+)
+
+// Retourne la taille maximale d'une requête encodée selon son type.
+func (c binaryCodec) maxRequestSize(reqType int) int {
+	size := 1 + IdSize + 1 + maxAddrSize
+	if c.signed {
+		size += requestSignatureSize
+	}
+
+	switch reqType {
+	case PingRequestType, ObservedAddrRequestType, LeaveRequestType:
+		return size
+	case FindNodeRequestType, FindValueRequestType:
+		return size + IdSize
+	case StoreRequestType:
+		return size + IdSize + ValueSize
+	default:
+		return 0
+	}
+}
+
+// Retourne la taille maximale d'une réponse encodée selon son type.
+func (c binaryCodec) maxResponseSize(reqType int) int {
+	peersSize := 1 + maxResponsePeers*encodedPeerSize
+	size := 1
+	if c.signed {
+		size += responseSignatureSize
+	}
+
+	switch reqType {
+	case PingRequestType:
+		return size + IdSize
+	case FindNodeRequestType:
+		return size + peersSize
+	case FindValueRequestType:
+		return size + 1 + max(ValueSize, peersSize)
+	case StoreRequestType:
+		return size + 1
+	case ObservedAddrRequestType:
+		return size + 1 + maxAddrSize
+	case LeaveRequestType:
+		return size
+	default:
+		return 0
+	}
+}
+
+func (c binaryCodec) encodeRequest(req Request) ([]byte, error) {
+	if len(req.SenderAddr) > maxAddrSize {
+		return nil, fmt.Errorf("%w: address too long", errMalformedMessage)
+	}
+
+	buf := make([]byte, 0, c.maxRequestSize(req.Type))
+	buf = append(buf, byte(req.Type))
+	buf = append(buf, req.SenderId[:]...)
+	buf = appendString(buf, req.SenderAddr)
+
+	switch req.Type {
+	case PingRequestType, ObservedAddrRequestType, LeaveRequestType:
+	case FindNodeRequestType, FindValueRequestType:
+		buf = append(buf, req.Id[:]...)
+	case StoreRequestType:
+		buf = append(buf, req.Id[:]...)
+		buf = append(buf, req.Value[:]...)
+	default:
+		return nil, fmt.Errorf("%w: unknown request type %d", errMalformedMessage, req.Type)
+	}
+
+	if c.signed {
+		buf = append(buf, req.PublicKey[:]...)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(req.Timestamp))
+		buf = append(buf, req.Signature[:]...)
+	}
+
+	return buf, nil
+}
+
+func (c binaryCodec) decodeRequest(data []byte) (Request, error) {
+	var req Request
+	r := binaryReader{data: data}
+
+	req.Type = int(r.readByte())
+	if len(data) > c.maxRequestSize(req.Type) {
+		return req, fmt.Errorf("%w: request too large", errMalformedMessage)
+	}
+
+	r.readInto(req.SenderId[:])
+	req.SenderAddr = r.readString()
+
+	switch req.Type {
+	case FindNodeRequestType, FindValueRequestType:
+		r.readInto(req.Id[:])
+	case StoreRequestType:
+		r.readInto(req.Id[:])
+		r.readInto(req.Value[:])
+	}
+
+	if c.signed {
+		r.readInto(req.PublicKey[:])
+		req.Timestamp = int64(r.readUint64())
+		r.readInto(req.Signature[:])
+	}
+
+	return req, r.finish()
+}
+
+func (c binaryCodec) encodeResponse(res Response) ([]byte, error) {
+	if res.Busy {
+		if !c.busy {
+			return nil, fmt.Errorf("%w: busy response not supported", errMalformedMessage)
+		}
+		retryAfter := min((res.RetryAfter + time.Millisecond - 1).Milliseconds(), math.MaxUint32)
+		return binary.BigEndian.AppendUint32([]byte{busyResponseType}, uint32(retryAfter)), nil
+	}
+
+	buf := make([]byte, 0, c.maxResponseSize(res.Type))
+	buf = append(buf, byte(res.Type))
+
+	var err error
+
+	switch res.Type {
+	case PingRequestType:
+		buf = append(buf, res.Id[:]...)
+	case FindNodeRequestType:
+		buf, err = appendPeers(buf, res.Peers)
+	case FindValueRequestType:
+		buf = appendBool(buf, res.Found)
+		if res.Found {
+			buf = append(buf, res.Value[:]...)
+		} else {
+			buf, err = appendPeers(buf, res.Peers)
+		}
+	case StoreRequestType:
+		buf = appendBool(buf, res.Ok)
+	case ObservedAddrRequestType:
+		if len(res.Addr) > maxAddrSize {
+			err = fmt.Errorf("%w: address too long", errMalformedMessage)
+		}
+		buf = appendString(buf, res.Addr)
+	case LeaveRequestType:
+	default:
+		err = fmt.Errorf("%w: unknown response type %d", errMalformedMessage, res.Type)
+	}
+
+	if c.signed {
+		buf = append(buf, res.PublicKey[:]...)
+		buf = append(buf, res.Signature[:]...)
+	}
+
+	return buf, err
+}
+
+func (c binaryCodec) decodeResponse(data []byte, reqType int) (Response, error) {
+	var res Response
+	r := binaryReader{data: data}
+
+	res.Type = int(r.readByte())
+	if c.busy && res.Type == busyResponseType {
+		res.Type = reqType
+		res.Busy = true
+		res.RetryAfter = time.Duration(r.readUint32()) * time.Millisecond
+		return res, r.finish()
+	}
+
+	if r.err == nil && res.Type != reqType {
+		return res, fmt.Errorf("%w: unexpected response type %d", errMalformedMessage, res.Type)
+	}
+
+	if len(data) > c.maxResponseSize(res.Type) {
+		return res, fmt.Errorf("%w: response too large", errMalformedMessage)
+	}
+
+	switch res.Type {
+	case PingRequestType:
+		r.readInto(res.Id[:])
+	case FindNodeRequestType:
+		res.Peers = r.readPeers()
+	case FindValueRequestType:
+		res.Found = r.readBool()
+		if res.Found {
+			r.readInto(res.Value[:])
+		} else {
+			res.Peers = r.readPeers()
+		}
+	case StoreRequestType:
+		res.Ok = r.readBool()
+	case ObservedAddrRequestType:
+		res.Addr = r.readString()
+	}
+
+	if c.signed {
+		r.readInto(res.PublicKey[:])
+		r.readInto(res.Signature[:])
+	}
+
+	return res, r.finish()
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = append(buf, byte(len(s)))
+	return append(buf, s...)
+}
+
+func appendBool(buf []byte, b bool) []byte {
+	if b {
+		return append(buf, 1)
+	}
+	return append(buf, 0)
+}
+
+func appendPeers(buf []byte, peers []Peer) ([]byte, error) {
+	if len(peers) > maxResponsePeers {
+		return nil, fmt.Errorf("%w: too many peers", errMalformedMessage)
+	}
+
+	buf = append(buf, byte(len(peers)))
+	for _, peer := range peers {
+		if len(peer.Addr) > maxAddrSize {
+			return nil, fmt.Errorf("%w: address too long", errMalformedMessage)
+		}
+
+		buf = append(buf, peer.Id[:]...)
+		buf = appendString(buf, peer.Addr)
+	}
+
+	return buf, nil
+}
+
+// binaryReader lit les champs d'un message binaire. La première erreur
+// est conservée et les lectures suivantes sont ignorées.
+type binaryReader struct {
+	data []byte
+	err  error
+}
+
+func (r *binaryReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+
+	if len(r.data) < n {
+		r.err = fmt.Errorf("%w: truncated", errMalformedMessage)
+		return nil
+	}
+
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *binaryReader) readByte() byte {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *binaryReader) readBool() bool {
+	return r.readByte() == 1
+}
+
+func (r *binaryReader) readInto(dst []byte) {
+	copy(dst, r.next(len(dst)))
+}
+
+func (r *binaryReader) readUint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *binaryReader) readUint64() uint64 {
+	if b := r.next(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (r *binaryReader) readString() string {
+	return string(r.next(int(r.readByte())))
+}
+
+func (r *binaryReader) readPeers() []Peer {
+	count := int(r.readByte())
+	if count > maxResponsePeers {
+		r.err = fmt.Errorf("%w: too many peers", errMalformedMessage)
+		return nil
+	}
+
+	peers := make([]Peer, 0, count)
+	for range count {
+		var peer Peer
+		r.readInto(peer.Id[:])
+		peer.Addr = r.readString()
+		peers = append(peers, peer)
+	}
+
+	return peers
+}
+
+// Retourne l'erreur de lecture, ou une erreur si des octets n'ont pas
+// été lus.
+func (r *binaryReader) finish() error {
+	if r.err == nil && len(r.data) > 0 {
+		r.err = fmt.Errorf("%w: trailing bytes", errMalformedMessage)
+	}
+	return r.err
+}
+
+// gobCodec est le codec de la version 1 du protocole, conservé pour
+// communiquer avec les noeuds qui ne prennent pas en charge binaryCodec.
+// Les requêtes sont encodées entièrement et les réponses ont un type
+// différent selon la requête. Comme pour les autres versions, les
+// messages sont échangés dans des trames après la poignée de main : les
+// noeuds antérieurs au hello, qui échangent des messages gob sur une
+// connexion brute, ne sont pas pris en charge.
+type gobCodec struct{}
+
+// Réponse à FIND_VALUE dans la version 1 du protocole.
+type findValueResponse struct {
+	Found bool
+	Value Value
+	Nodes []Peer
+}
+
+func (gobCodec) encodeRequest(req Request) ([]byte, error) {
+	return encodeGob(req)
+}
+
+func (gobCodec) decodeRequest(data []byte) (Request, error) {
+	var req Request
+	err := decodeGob(data, &req)
+	return req, err
+}
+
+func (gobCodec) encodeResponse(res Response) ([]byte, error) {
+	if res.Busy {
+		return nil, fmt.Errorf("%w: busy response not supported", errMalformedMessage)
+	}
+
+	switch res.Type {
+	case PingRequestType:
+		return encodeGob(res.Id)
+	case FindNodeRequestType:
+		return encodeGob(res.Peers)
+	case FindValueRequestType:
+		return encodeGob(findValueResponse{
+			Found: res.Found,
+			Value: res.Value,
+			Nodes: res.Peers,
+		})
+	case StoreRequestType:
+		return encodeGob(res.Ok)
+	default:
+		return encodeGob(struct{}{})
+	}
+}
+
+func (gobCodec) decodeResponse(data []byte, reqType int) (Response, error) {
+	res := Response{Type: reqType}
+	var err error
+
+	switch reqType {
+	case PingRequestType:
+		err = decodeGob(data, &res.Id)
+	case FindNodeRequestType:
+		err = decodeGob(data, &res.Peers)
+	case FindValueRequestType:
+		var fv findValueResponse
+		err = decodeGob(data, &fv)
+		res.Found, res.Value, res.Peers = fv.Found, fv.Value, fv.Nodes
+	case StoreRequestType:
+		err = decodeGob(data, &res.Ok)
+	default:
+		err = fmt.Errorf("%w: unknown response type %d", errMalformedMessage, reqType)
+	}
+
+	return res, err
+}
+
+func encodeGob(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(v)
+	return buf.Bytes(), err
+}
+
+func decodeGob(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
@@ -0,0 +1,106 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	codec := codecFor(ProtocolVersion)
+
+	peers := []Peer{{Id: Id{1}, Addr: "127.0.0.1:42042"}, {Id: Id{2}, Addr: "node-b"}}
+	reqs := []Request{
+		newPingRequest(),
+		newFindNodeRequest(Id{3}),
+		newFindValueRequest(Id{4}),
+		newStoreRequest(Id{5}, Value{6}),
+		newObservedAddrRequest(),
+		newLeaveRequest(),
+	}
+	responses := []Response{
+		{Type: PingRequestType, Id: Id{7}},
+		{Type: FindNodeRequestType, Peers: peers},
+		{Type: FindValueRequestType, Found: true, Value: Value{8}},
+		{Type: StoreRequestType, Ok: true},
+		{Type: ObservedAddrRequestType, Addr: "10.0.0.1:1234"},
+		{Type: LeaveRequestType},
+	}
+
+	for i, req := range reqs {
+		req.SenderId = Id{9}
+		req.SenderAddr = "node-a"
+		req.PublicKey[0] = 10
+		req.Timestamp = 11
+		req.Signature[0] = 12
+
+		encoded, err := codec.encodeRequest(req)
+		if err != nil {
+			t.Fatalf("Erreur lors de l'encodage de la requête %d: %v", req.Type, err)
+		}
+		if len(encoded) > codec.(binaryCodec).maxRequestSize(req.Type) {
+			t.Fatalf("La requête %d dépasse sa taille maximale", req.Type)
+		}
+
+		decoded, err := codec.decodeRequest(encoded)
+		if err != nil || !reflect.DeepEqual(decoded, req) {
+			t.Fatalf("La requête %d décodée ne correspond pas: %v", req.Type, err)
+		}
+
+		res := responses[i]
+		res.PublicKey[0] = 13
+		res.Signature[0] = 14
+
+		encoded, err = codec.encodeResponse(res)
+		if err != nil {
+			t.Fatalf("Erreur lors de l'encodage de la réponse %d: %v", res.Type, err)
+		}
+
+		decodedRes, err := codec.decodeResponse(encoded, req.Type)
+		if err != nil || !reflect.DeepEqual(decodedRes, res) {
+			t.Fatalf("La réponse %d décodée ne correspond pas: %v", res.Type, err)
+		}
+	}
+}
+
+func TestCodecLimits(t *testing.T) {
+	codec := codecFor(ProtocolVersion)
+
+	req := newPingRequest()
+	req.SenderAddr = strings.Repeat("a", maxAddrSize+1)
+	if _, err := codec.encodeRequest(req); !errors.Is(err, errMalformedMessage) {
+		t.Fatalf("Une adresse trop longue aurait dû être refusée: %v", err)
+	}
+
+	res := Response{Type: FindNodeRequestType, Peers: make([]Peer, maxResponsePeers+1)}
+	if _, err := codec.encodeResponse(res); !errors.Is(err, errMalformedMessage) {
+		t.Fatalf("Une réponse avec trop de noeuds aurait dû être refusée: %v", err)
+	}
+
+	encoded, _ := codec.encodeRequest(newFindNodeRequest(Id{1}))
+	if _, err := codec.decodeRequest(encoded[:len(encoded)-1]); !errors.Is(err, errMalformedMessage) {
+		t.Fatalf("Une requête tronquée aurait dû être refusée: %v", err)
+	}
+	if _, err := codec.decodeRequest(append(encoded, 0)); !errors.Is(err, errMalformedMessage) {
+		t.Fatalf("Une requête suivie d'octets en trop aurait dû être refusée: %v", err)
+	}
+
+	encoded, _ = codec.encodeResponse(Response{Type: PingRequestType})
+	if _, err := codec.decodeResponse(encoded, StoreRequestType); !errors.Is(err, errMalformedMessage) {
+		t.Fatalf("Une réponse d'un autre type aurait dû être refusée: %v", err)
+	}
+
+	if err := writeFrame(&bytes.Buffer{}, 1, make([]byte, maxFrameSize+1)); !errors.Is(err, errFrameTooLarge) {
+		t.Fatalf("Une trame trop grande n'aurait pas dû être écrite: %v", err)
+	}
+
+	var frame bytes.Buffer
+	writeFrame(&frame, 1, make([]byte, maxFrameSize))
+	oversized := frame.Bytes()
+	oversized[8] = 0xff // taille annoncée supérieure à maxFrameSize
+	if _, _, err := readFrame(bytes.NewReader(oversized)); !errors.Is(err, errFrameTooLarge) {
+		t.Fatalf("Une trame trop grande n'aurait pas dû être lue: %v", err)
+	}
+}
@@ -1,6 +1,8 @@
 package core
 
 import (
+	"errors"
+	"fmt"
 	"time"
 )
 
@@ -8,16 +10,206 @@ const (
 	IdSize    = 20   // taille des identifiants en octet
 	ValueSize = 1024 // taille d'une valeur en octet
 
-	// nombre de noeuds à interroger à chaque itération de FindNode et FindValue
-	batchSize        = 3
-	maxReplicasCount = 5
+	maxResponsePeers = 20 // nombre maximal de noeuds dans une réponse
 
-	bucketCapacity = 20 // nombre maximum de noeuds connus = 8*IdSize*bucketCapacity
+	maxClockSkew = 5 * time.Minute // écart maximal entre la date d'une requête et l'horloge locale
 
-	storageTtl      = 60 * time.Minute // durée de vie d'une valeur
-	storageCapacity = 64 * 1024        // nombre de valeurs maximal
+	verifiedAddrTtl = 30 * time.Minute // durée pendant laquelle une adresse vérifiée n'est pas revérifiée
+	maxPendingPeers = 64               // nombre maximal de noeuds en attente de vérification
 
-	connTtl = 3 * time.Second // durée de vie maximale d'une connexion
+	maxFrameSize  = 16 * 1024 // taille maximale d'une trame en octet
+	maxRecordSize = 16 * 1024 // taille maximale d'un enregistrement chiffré en octet
 
-	cleanupFreq = time.Minute * 10 // fréquence de nettoyage de la table de routage
+	maxDatagramSize    = 1400                   // taille maximale d'un datagramme en octet, sans fragmentation
+	datagramRetries    = 3                      // nombre d'envois d'une requête par datagramme
+	datagramRetryDelay = 250 * time.Millisecond // délai avant de renvoyer un datagramme
+	datagramBackoff    = 10 * time.Minute       // durée sans datagramme vers un noeud qui n'y répond pas
+
+	transferQueueSize = 256 // nombre maximal de nouveaux noeuds en attente de transmission
+	eventQueueSize    = 256 // nombre maximal d'événements en attente de lecture par un abonné
+
+	admissionCleanupFreq = 30 * time.Second // fréquence d'oubli des limites de débit échues
+	queueRetryAfter      = time.Second      // délai demandé aux émetteurs lorsque la file des requêtes est pleine
+	maxBusyBackoff       = 30 * time.Second // durée maximale de suspension des requêtes vers un noeud surchargé
+	drainConcurrency     = 8                // nombre de valeurs transmises simultanément par un noeud quittant le réseau
+
+	minAcceptDelay = 5 * time.Millisecond // délai avant d'accepter à nouveau une connexion après un échec
+	maxAcceptDelay = time.Second          // délai maximal après des échecs consécutifs
 )
+
+// Config contient les paramètres d'un noeud et de son stockage. Les
+// noeuds d'un même réseau peuvent avoir des paramètres différents, mais
+// StorageTtl doit être le même partout pour que les valeurs soient
+// republiées à temps.
+type Config struct {
+	// nombre de noeuds interrogés simultanément par FindNode et FindValue
+	BatchSize        int
+	MaxReplicasCount int // nombre maximal de replicas d'une valeur
+	MinReplicasCount int // nombre de replicas en dessous duquel Host.Publish échoue
+
+	BucketCapacity       int // nombre maximum de noeuds connus = 8*IdSize*BucketCapacity
+	ReplacementCacheSize int // nombre maximum de remplaçants par bucket
+	MaxPeerFailures      int // nombre d'échecs consécutifs avant de retirer un noeud
+
+	StorageTtl      time.Duration // durée de vie d'une valeur
+	StorageCapacity int           // nombre de valeurs maximal
+
+	ConnTtl      time.Duration // délai maximal d'attente d'une réponse
+	ConnIdleTtl  time.Duration // durée d'inactivité avant qu'un noeud ferme une connexion entrante
+	PoolIdleTtl  time.Duration // durée d'inactivité avant qu'une connexion sortante soit fermée
+	PoolCapacity int           // nombre maximal de connexions sortantes persistantes
+
+	CleanupFreq   time.Duration // fréquence de nettoyage de la table de routage
+	RefreshFreq   time.Duration // délai sans recherche avant de rafraîchir un bucket
+	ReplicateFreq time.Duration // fréquence de republication des valeurs détenues localement
+	RepublishFreq time.Duration // fréquence de republication des valeurs publiées par le noeud local
+
+	PublishedTtl time.Duration // durée pendant laquelle une valeur publiée par le noeud local est republiée
+	MaxPublished int           // nombre maximal de valeurs publiées republiées par le noeud local
+
+	TransferRate int // nombre maximal de valeurs transmises par seconde aux nouveaux noeuds
+
+	// Contrôle d'admission des requêtes reçues, voir admission.go. Les
+	// recherches regroupent toutes les requêtes autres que STORE.
+	MaxInboundConns int       // nombre maximal de connexions entrantes simultanées
+	PeerStoreLimit  RateLimit // stockages par émetteur
+	PeerLookupLimit RateLimit // recherches par émetteur
+	IpStoreLimit    RateLimit // stockages par adresse IP
+	IpLookupLimit   RateLimit // recherches par adresse IP
+	// Exempte des limites par adresse IP les adresses de boucle locale et
+	// les transports sans IP, par exemple pour un réseau de test sur une
+	// seule machine. Un noeud placé derrière un proxy local ne doit pas
+	// l'activer, toutes ses requêtes semblant venir de la boucle locale.
+	ExemptLocalAddrs bool
+
+	RequestWorkers   int // nombre de requêtes reçues traitées simultanément
+	RequestQueueSize int // nombre maximal de requêtes reçues en attente, par priorité
+
+	// Accepte les noeuds antérieurs à secureVersion, avec lesquels les
+	// connexions ne sont ni chiffrées ni authentifiées. Un intermédiaire
+	// peut alors désactiver le chiffrement entre deux noeuds récents.
+	AllowInsecure bool
+}
+
+// RateLimit est le débit autorisé par un seau à jetons : Rate jetons
+// par seconde, et au plus Burst jetons accumulés.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// Retourne la configuration par défaut.
+func DefaultConfig() Config {
+	return Config{
+		BatchSize:        3,
+		MaxReplicasCount: 5,
+		MinReplicasCount: 1,
+
+		BucketCapacity:       20,
+		ReplacementCacheSize: 10,
+		MaxPeerFailures:      3,
+
+		StorageTtl:      60 * time.Minute,
+		StorageCapacity: 64 * 1024,
+
+		ConnTtl:      3 * time.Second,
+		ConnIdleTtl:  2 * time.Minute,
+		PoolIdleTtl:  1 * time.Minute,
+		PoolCapacity: 32,
+
+		CleanupFreq:   10 * time.Minute,
+		RefreshFreq:   15 * time.Minute,
+		ReplicateFreq: 15 * time.Minute,
+		RepublishFreq: 30 * time.Minute,
+
+		PublishedTtl: 24 * time.Hour,
+		MaxPublished: 64 * 1024,
+
+		TransferRate: 50,
+
+		MaxInboundConns: 256,
+		PeerStoreLimit:  RateLimit{Rate: 50, Burst: 200},
+		PeerLookupLimit: RateLimit{Rate: 100, Burst: 500},
+		IpStoreLimit:    RateLimit{Rate: 200, Burst: 1000},
+		IpLookupLimit:   RateLimit{Rate: 500, Burst: 2500},
+
+		RequestWorkers:   32,
+		RequestQueueSize: 1024,
+	}
+}
+
+var ErrInvalidConfig = errors.New("invalid config")
+
+// Vérifie que la configuration est utilisable.
+func (c Config) Validate() error {
+	positive := []struct {
+		name  string
+		value int64
+	}{
+		{"BatchSize", int64(c.BatchSize)},
+		{"MaxReplicasCount", int64(c.MaxReplicasCount)},
+		{"MinReplicasCount", int64(c.MinReplicasCount)},
+		{"BucketCapacity", int64(c.BucketCapacity)},
+		{"MaxPeerFailures", int64(c.MaxPeerFailures)},
+		{"StorageTtl", int64(c.StorageTtl)},
+		{"StorageCapacity", int64(c.StorageCapacity)},
+		{"ConnTtl", int64(c.ConnTtl)},
+		{"ConnIdleTtl", int64(c.ConnIdleTtl)},
+		{"PoolIdleTtl", int64(c.PoolIdleTtl)},
+		{"PoolCapacity", int64(c.PoolCapacity)},
+		{"CleanupFreq", int64(c.CleanupFreq)},
+		{"RefreshFreq", int64(c.RefreshFreq)},
+		{"ReplicateFreq", int64(c.ReplicateFreq)},
+		{"RepublishFreq", int64(c.RepublishFreq)},
+		{"PublishedTtl", int64(c.PublishedTtl)},
+		{"MaxPublished", int64(c.MaxPublished)},
+		{"TransferRate", int64(c.TransferRate)},
+		{"MaxInboundConns", int64(c.MaxInboundConns)},
+		{"RequestWorkers", int64(c.RequestWorkers)},
+		{"RequestQueueSize", int64(c.RequestQueueSize)},
+	}
+
+	for _, field := range positive {
+		if field.value <= 0 {
+			return fmt.Errorf("%w: %s must be positive", ErrInvalidConfig, field.name)
+		}
+	}
+
+	limits := []struct {
+		name  string
+		limit RateLimit
+	}{
+		{"PeerStoreLimit", c.PeerStoreLimit},
+		{"PeerLookupLimit", c.PeerLookupLimit},
+		{"IpStoreLimit", c.IpStoreLimit},
+		{"IpLookupLimit", c.IpLookupLimit},
+	}
+
+	for _, field := range limits {
+		if !(field.limit.Rate > 0) || field.limit.Burst <= 0 {
+			return fmt.Errorf("%w: %s must have a positive rate and burst", ErrInvalidConfig, field.name)
+		}
+	}
+
+	if c.ReplacementCacheSize < 0 {
+		return fmt.Errorf("%w: ReplacementCacheSize must not be negative", ErrInvalidConfig)
+	}
+
+	if c.MinReplicasCount > c.MaxReplicasCount {
+		return fmt.Errorf("%w: MinReplicasCount must not exceed MaxReplicasCount", ErrInvalidConfig)
+	}
+
+	if c.BatchSize > c.BucketCapacity {
+		return fmt.Errorf("%w: BatchSize must not exceed BucketCapacity", ErrInvalidConfig)
+	}
+
+	if c.ReplicateFreq >= c.StorageTtl || c.RepublishFreq >= c.StorageTtl {
+		return fmt.Errorf("%w: values must be republished before StorageTtl", ErrInvalidConfig)
+	}
+
+	if c.TransferRate > int(time.Second) {
+		return fmt.Errorf("%w: TransferRate must not exceed %d", ErrInvalidConfig, int(time.Second))
+	}
+
+	return nil
+}
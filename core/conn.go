@@ -0,0 +1,221 @@
+package core
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Taille de l'entête d'une trame : identifiant de requête (8 octets)
+// suivi de la taille du contenu (4 octets).
+const frameHeaderSize = 12
+
+var (
+	errConnClosed    = errors.New("connection closed")
+	errFrameTooLarge = errors.New("frame too large")
+)
+
+// Écrit une trame contenant le contenu associé à un identifiant de requête.
+func writeFrame(w io.Writer, reqId uint64, payload []byte) error {
+	if len(payload) > maxFrameSize {
+		return errFrameTooLarge
+	}
+
+	frame := make([]byte, frameHeaderSize+len(payload))
+	binary.BigEndian.PutUint64(frame[0:8], reqId)
+	binary.BigEndian.PutUint32(frame[8:12], uint32(len(payload)))
+	copy(frame[frameHeaderSize:], payload)
+
+	_, err := w.Write(frame)
+	return err
+}
+
+// Lit une trame et retourne son identifiant de requête et son contenu.
+func readFrame(r io.Reader) (uint64, []byte, error) {
+	var header [frameHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+
+	reqId := binary.BigEndian.Uint64(header[0:8])
+	size := binary.BigEndian.Uint32(header[8:12])
+	if size > maxFrameSize {
+		return 0, nil, errFrameTooLarge
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+
+	return reqId, payload, nil
+}
+
+// peerConn est une connexion persistante vers un noeud distant sur
+// laquelle plusieurs requêtes peuvent être en cours simultanément.
+// Les réponses sont associées aux requêtes par leur identifiant.
+// peerConn est sûre pour une utilisation concurrente.
+type peerConn struct {
+	conn    net.Conn
+	session session       // convenue lors de la poignée de main
+	ttl     time.Duration // délai maximal d'attente d'une réponse
+	writeMu sync.Mutex
+
+	mu       sync.Mutex
+	pending  map[uint64]chan []byte
+	nextId   uint64
+	lastUsed time.Time
+	closed   bool
+	done     chan struct{}
+}
+
+func newPeerConn(conn net.Conn, session session, ttl time.Duration) *peerConn {
+	c := &peerConn{
+		conn:     conn,
+		session:  session,
+		ttl:      ttl,
+		pending:  make(map[uint64]chan []byte),
+		lastUsed: time.Now(),
+		done:     make(chan struct{}),
+	}
+
+	go c.readLoop()
+
+	return c
+}
+
+// Encode une requête avec le codec de la session, l'envoie et décode
+// sa réponse. Une requête dont le type n'est pas pris en charge par le
+// noeud distant n'est pas envoyée. Sur une connexion chiffrée, la
+// réponse doit être signée par le noeud authentifié.
+func (c *peerConn) send(ctx context.Context, req Request) (Response, error) {
+	if !c.session.caps.has(req.Type) {
+		return Response{}, errUnsupportedRequest
+	}
+
+	codec := codecFor(c.session.version)
+
+	payload, err := codec.encodeRequest(req)
+	if err != nil {
+		return Response{}, err
+	}
+
+	res, err := c.request(ctx, payload)
+	if err != nil {
+		return Response{}, err
+	}
+
+	decoded, err := codec.decodeResponse(res, req.Type)
+	if err != nil {
+		return Response{}, err
+	}
+
+	if !decoded.Busy && !c.session.acceptsResponse(decoded) {
+		return Response{}, errUnexpectedPeer
+	}
+
+	return decoded, nil
+}
+
+// Envoie une requête encodée et attend sa réponse pendant au plus ttl,
+// ou jusqu'à l'annulation de ctx.
+func (c *peerConn) request(ctx context.Context, payload []byte) ([]byte, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, errConnClosed
+	}
+
+	c.nextId++
+	reqId := c.nextId
+	resChan := make(chan []byte, 1)
+	c.pending[reqId] = resChan
+	c.lastUsed = time.Now()
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, reqId)
+		c.lastUsed = time.Now()
+		c.mu.Unlock()
+	}()
+
+	c.writeMu.Lock()
+	c.conn.SetWriteDeadline(time.Now().Add(c.ttl))
+	err := writeFrame(c.conn, reqId, payload)
+	c.writeMu.Unlock()
+
+	if err != nil {
+		c.close()
+		return nil, err
+	}
+
+	timer := time.NewTimer(c.ttl)
+	defer timer.Stop()
+
+	select {
+	case res := <-resChan:
+		return res, nil
+	case <-c.done:
+		return nil, errConnClosed
+	case <-timer.C:
+		return nil, ErrTimeout
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Lit les réponses et les transmet aux requêtes en attente. Une requête
+// ne reçoit que la première réponse portant son identifiant, les
+// suivantes sont ignorées.
+func (c *peerConn) readLoop() {
+	defer c.close()
+
+	for {
+		reqId, payload, err := readFrame(c.conn)
+		if err != nil {
+			return
+		}
+
+		c.mu.Lock()
+		if resChan, ok := c.pending[reqId]; ok {
+			delete(c.pending, reqId)
+			select {
+			case resChan <- payload:
+			default:
+			}
+		}
+		c.mu.Unlock()
+	}
+}
+
+func (c *peerConn) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.closed {
+		c.closed = true
+		close(c.done)
+		c.conn.Close()
+	}
+}
+
+func (c *peerConn) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.closed
+}
+
+// Indique depuis quand la connexion n'a plus de requête en cours. La
+// deuxième valeur de retour est false si des requêtes sont en cours.
+func (c *peerConn) idleSince() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lastUsed, len(c.pending) == 0
+}
@@ -0,0 +1,380 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// Un PacketTransport est un Transport capable d'échanger des
+// datagrammes. Un Host utilisant un PacketTransport envoie les requêtes
+// légères (ping, FIND_NODE et FIND_VALUE) par datagramme.
+type PacketTransport interface {
+	Transport
+	// ListenPacket reçoit et envoie des datagrammes depuis l'adresse addr.
+	ListenPacket(addr string) (net.PacketConn, error)
+	// ResolveAddr convertit l'adresse d'un noeud en adresse de datagramme.
+	ResolveAddr(addr string) (net.Addr, error)
+}
+
+// UDPTransport est un PacketTransport qui utilise UDP pour les requêtes
+// légères et TCP pour les autres requêtes, sur la même adresse.
+type UDPTransport struct {
+	TCPTransport
+}
+
+func NewUDPTransport() *UDPTransport {
+	return &UDPTransport{}
+}
+
+func (*UDPTransport) ListenPacket(addr string) (net.PacketConn, error) {
+	return net.ListenPacket("udp", addr)
+}
+
+func (*UDPTransport) ResolveAddr(addr string) (net.Addr, error) {
+	return net.ResolveUDPAddr("udp", addr)
+}
+
+// Types de datagramme.
+const (
+	datagramRequest  = iota
+	datagramResponse // réponse à une requête
+	datagramRedirect // la réponse doit être demandée par connexion
+)
+
+// Taille de l'entête d'un datagramme : type (1 octet), version du
+// protocole (2 octets), étiquette du réseau (4 octets) et identifiant de
+// requête (8 octets).
+const datagramHeaderSize = 15
+
+var errRedirected = errors.New("response must be requested over a stream")
+
+// datagramConn envoie des requêtes et y répond par datagramme. Les
+// réponses sont associées aux requêtes par leur identifiant, et une
+// requête sans réponse est renvoyée jusqu'à datagramRetries fois. Les
+// datagrammes d'un autre réseau ou d'une version antérieure à
+// minVersion sont ignorés. datagramConn est sûre pour une utilisation
+// concurrente.
+type datagramConn struct {
+	conn       net.PacketConn
+	transport  PacketTransport
+	tag        uint32 // étiquette du réseau
+	minVersion uint16 // plus ancienne version acceptée
+	handler    func(version uint16, payload []byte, from net.Addr) ([]byte, bool)
+
+	mu      sync.Mutex
+	pending map[uint64]chan []byte
+	wg      sync.WaitGroup
+}
+
+// Crée une datagramConn. handler traite une requête reçue d'une adresse
+// dans une version du protocole et retourne la réponse encodée dans la
+// même version, ou false si elle doit être demandée par connexion.
+func newDatagramConn(
+	conn net.PacketConn,
+	transport PacketTransport,
+	tag uint32,
+	minVersion uint16,
+	handler func(uint16, []byte, net.Addr) ([]byte, bool),
+) *datagramConn {
+	c := &datagramConn{
+		conn:       conn,
+		transport:  transport,
+		tag:        tag,
+		minVersion: minVersion,
+		handler:    handler,
+		pending:    make(map[uint64]chan []byte),
+	}
+
+	c.wg.Add(1)
+	go c.readLoop()
+
+	return c
+}
+
+// Envoie une requête au noeud[addr] et attend sa réponse, au plus
+// jusqu'à l'annulation de ctx.
+func (c *datagramConn) request(ctx context.Context, addr string, payload []byte) ([]byte, error) {
+	if datagramHeaderSize+len(payload) > maxDatagramSize {
+		return nil, errFrameTooLarge
+	}
+
+	to, err := c.transport.ResolveAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	reqId := c.newRequestId()
+	resChan := make(chan []byte, 1)
+	c.pending[reqId] = resChan
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, reqId)
+		c.mu.Unlock()
+	}()
+
+	datagram := c.newDatagram(datagramRequest, ProtocolVersion, reqId, payload)
+
+	for range datagramRetries {
+		if _, err := c.conn.WriteTo(datagram, to); err != nil {
+			return nil, err
+		}
+
+		timer := time.NewTimer(datagramRetryDelay)
+
+		select {
+		case res := <-resChan:
+			timer.Stop()
+			if res == nil {
+				return nil, errRedirected
+			}
+			return res, nil
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+
+	return nil, ErrTimeout
+}
+
+// Retourne un identifiant de requête aléatoire, distinct de ceux des
+// requêtes en attente. Les datagrammes n'étant pas authentifiés, un
+// identifiant prévisible permettrait à un tiers de forger une réponse.
+// c.mu doit être verrouillé.
+func (c *datagramConn) newRequestId() uint64 {
+	var b [8]byte
+	for {
+		rand.Read(b[:])
+		if reqId := binary.BigEndian.Uint64(b[:]); c.pending[reqId] == nil {
+			return reqId
+		}
+	}
+}
+
+// Lit les datagrammes reçus jusqu'à la fermeture de la connexion.
+func (c *datagramConn) readLoop() {
+	defer c.wg.Done()
+
+	buf := make([]byte, maxDatagramSize)
+
+	for {
+		n, from, err := c.conn.ReadFrom(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil || n < datagramHeaderSize {
+			continue
+		}
+
+		kind := buf[0]
+		version := binary.BigEndian.Uint16(buf[1:3])
+		tag := binary.BigEndian.Uint32(buf[3:7])
+		reqId := binary.BigEndian.Uint64(buf[7:datagramHeaderSize])
+
+		if tag != c.tag || version < c.minVersion {
+			continue
+		}
+
+		payload := make([]byte, n-datagramHeaderSize)
+		copy(payload, buf[datagramHeaderSize:n])
+
+		switch kind {
+		case datagramRequest:
+			c.wg.Add(1)
+			go c.reply(from, version, reqId, payload)
+
+		case datagramResponse, datagramRedirect:
+			// Une réponse dans une autre version que celle de la requête
+			// est redemandée par connexion.
+			if kind == datagramRedirect || version != ProtocolVersion {
+				payload = nil
+			}
+
+			c.mu.Lock()
+			if resChan, ok := c.pending[reqId]; ok {
+				select {
+				case resChan <- payload:
+				default:
+				}
+			}
+			c.mu.Unlock()
+		}
+	}
+}
+
+func (c *datagramConn) reply(to net.Addr, version uint16, reqId uint64, payload []byte) {
+	defer c.wg.Done()
+
+	kind := byte(datagramResponse)
+	res, ok := c.handler(version, payload, to)
+	if !ok || datagramHeaderSize+len(res) > maxDatagramSize {
+		kind = datagramRedirect
+		res = nil
+	}
+
+	c.conn.WriteTo(c.newDatagram(kind, version, reqId, res), to)
+}
+
+func (c *datagramConn) newDatagram(kind byte, version uint16, reqId uint64, payload []byte) []byte {
+	datagram := make([]byte, datagramHeaderSize+len(payload))
+	datagram[0] = kind
+	binary.BigEndian.PutUint16(datagram[1:3], version)
+	binary.BigEndian.PutUint32(datagram[3:7], c.tag)
+	binary.BigEndian.PutUint64(datagram[7:datagramHeaderSize], reqId)
+	copy(datagram[datagramHeaderSize:], payload)
+
+	return datagram
+}
+
+// Envoie une requête encodée dans la version courante du protocole au
+// noeud[addr] et décode sa réponse.
+func requestDatagram(ctx context.Context, c *datagramConn, addr string, req Request) (Response, error) {
+	codec := codecFor(ProtocolVersion)
+
+	payload, err := codec.encodeRequest(req)
+	if err != nil {
+		return Response{}, err
+	}
+
+	res, err := c.request(ctx, addr, payload)
+	if err != nil {
+		return Response{}, err
+	}
+
+	return codec.decodeResponse(res, req.Type)
+}
+
+func (c *datagramConn) close() {
+	c.conn.Close()
+	c.wg.Wait()
+}
+
+// Prise en charge des datagrammes par un noeud distant.
+type datagramSupport int
+
+const (
+	datagramUnknown datagramSupport = iota
+	datagramProbing
+	datagramSupported
+	datagramUnsupported
+)
+
+type datagramPeer struct {
+	support datagramSupport
+	until   time.Time // fin de validité de datagramSupported et datagramUnsupported
+}
+
+// Retourne la connexion par datagramme du noeud local, ou nil si son
+// transport ne le permet pas. Un noeud qui n'écoute pas reçoit les
+// réponses sur une adresse éphémère.
+func (h *Host) datagramConn() *datagramConn {
+	pt, ok := h.transport.(PacketTransport)
+	if !ok {
+		return nil
+	}
+
+	h.datagramsMu.Lock()
+	defer h.datagramsMu.Unlock()
+
+	if h.datagrams == nil {
+		conn, err := pt.ListenPacket("")
+		if err != nil {
+			return nil
+		}
+		h.datagrams = newDatagramConn(h.meterPacketConn(conn), pt, networkTag(h.networkId), h.minVersion(), h.handleDatagram)
+	}
+
+	return h.datagrams
+}
+
+// Indique si les requêtes vers le noeud[addr] peuvent être envoyées par
+// datagramme. Lors du premier contact avec un noeud, puis toutes les
+// datagramBackoff, un ping lui est envoyé par datagramme en arrière-plan
+// pour le déterminer, et les requêtes sont envoyées par connexion en
+// attendant. Un noeud local qui n'est pas démarré ne l'envoie pas, et
+// un ping interrompu par son arrêt laisse la prise en charge inconnue.
+func (h *Host) acceptsDatagrams(dc *datagramConn, addr string) bool {
+	h.datagramsMu.Lock()
+	defer h.datagramsMu.Unlock()
+
+	peer := h.datagramPeers[addr]
+
+	switch peer.support {
+	case datagramSupported:
+		if time.Now().Before(peer.until) {
+			return true
+		}
+
+	case datagramUnsupported:
+		if time.Now().Before(peer.until) {
+			return false
+		}
+	case datagramProbing:
+		return false
+	}
+
+	started := h.goBackground(func(ctx context.Context) {
+		req := h.sign(newPingRequest())
+		_, err := requestDatagram(ctx, dc, addr, req)
+		switch {
+		case ctx.Err() != nil:
+			h.datagramsMu.Lock()
+			delete(h.datagramPeers, addr)
+			h.datagramsMu.Unlock()
+		case err == nil:
+			h.setDatagramSupport(addr, datagramSupported)
+		default:
+			h.log.rpc.Debug("peer does not answer datagrams", "addr", addr, "err", err)
+			h.setDatagramSupport(addr, datagramUnsupported)
+		}
+	})
+
+	if started {
+		h.datagramPeers[addr] = datagramPeer{support: datagramProbing}
+	}
+
+	return false
+}
+
+func (h *Host) setDatagramSupport(addr string, support datagramSupport) {
+	h.datagramsMu.Lock()
+	defer h.datagramsMu.Unlock()
+
+	h.datagramPeers[addr] = datagramPeer{
+		support: support,
+		until:   time.Now().Add(datagramBackoff),
+	}
+}
+
+// Oublie la prise en charge des datagrammes par le noeud[addr].
+func (h *Host) forgetDatagramSupport(addr string) {
+	h.datagramsMu.Lock()
+	defer h.datagramsMu.Unlock()
+
+	if h.datagramPeers[addr].support != datagramProbing {
+		delete(h.datagramPeers, addr)
+	}
+}
+
+// Oublie la prise en charge des datagrammes par les noeuds dont l'état
+// a expiré. Elle sera déterminée à nouveau lors du prochain contact.
+func (h *Host) pruneDatagramPeers() {
+	h.datagramsMu.Lock()
+	defer h.datagramsMu.Unlock()
+
+	now := time.Now()
+	for addr, peer := range h.datagramPeers {
+		if peer.support != datagramProbing && now.After(peer.until) {
+			delete(h.datagramPeers, addr)
+		}
+	}
+}
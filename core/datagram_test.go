@@ -0,0 +1,33 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDatagramPeersBound(t *testing.T) {
+	h := NewHost("node-a", NewMemoryStorage(), WithTransport(NewMemoryTransport()))
+
+	peer := Peer{Id: NewRandomId(), Addr: "node-b"}
+	h.rt.addPeer(peer)
+	h.setDatagramSupport(peer.Addr, datagramSupported)
+	h.setDatagramSupport("node-c", datagramUnsupported)
+
+	// La prise en charge d'un noeud retiré de la table de routage est
+	// oubliée.
+	h.removePeer(peer.Id)
+	if _, ok := h.datagramPeers[peer.Addr]; ok {
+		t.Fatal("La prise en charge des datagrammes d'un noeud retiré aurait dû être oubliée")
+	}
+
+	h.pruneDatagramPeers()
+	if _, ok := h.datagramPeers["node-c"]; !ok {
+		t.Fatal("La prise en charge des datagrammes n'aurait pas dû être oubliée avant son expiration")
+	}
+
+	h.datagramPeers["node-c"] = datagramPeer{support: datagramUnsupported, until: time.Now().Add(-time.Second)}
+	h.pruneDatagramPeers()
+	if len(h.datagramPeers) != 0 {
+		t.Fatalf("La prise en charge des datagrammes expirée aurait dû être oubliée: %v", h.datagramPeers)
+	}
+}
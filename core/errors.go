@@ -0,0 +1,86 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+var (
+	// La valeur n'a été trouvée sur aucun des noeuds interrogés.
+	ErrNotFound = errors.New("value not found")
+	// Aucun noeud n'a pu être joint.
+	ErrNoPeers = errors.New("no reachable peers")
+	// Une requête ou une opération a dépassé son délai.
+	ErrTimeout = errors.New("request timed out")
+	// Une valeur a été stockée sur trop peu de noeuds, voir
+	// InsufficientReplicasError.
+	ErrInsufficientReplicas = errors.New("insufficient replicas")
+	// Un noeud surchargé a refusé la requête, voir BusyError.
+	ErrPeerBusy = errors.New("peer busy")
+	// Start a été appelé sur un noeud déjà démarré.
+	ErrHostRunning = errors.New("host already running")
+
+	errCorruptValue = errors.New("value does not match its id")
+)
+
+// InsufficientReplicasError indique qu'une valeur a été stockée sur
+// moins de MinReplicasCount noeuds.
+type InsufficientReplicasError struct {
+	Id       Id
+	Replicas int // nombre de replicas stockés
+	Required int // nombre minimal de replicas attendus
+}
+
+func (e *InsufficientReplicasError) Error() string {
+	return fmt.Sprintf("%s stored on %d peers, %d required", e.Id, e.Replicas, e.Required)
+}
+
+func (e *InsufficientReplicasError) Unwrap() error {
+	return ErrInsufficientReplicas
+}
+
+// BusyError indique qu'un noeud surchargé a refusé une requête. Si le
+// refus a été reçu sur une connexion chiffrée, les requêtes vers ce
+// noeud échouent sans être envoyées jusqu'à la fin de RetryAfter.
+type BusyError struct {
+	Addr       string
+	RetryAfter time.Duration
+}
+
+func (e *BusyError) Error() string {
+	return fmt.Sprintf("%s busy, retry after %s", e.Addr, e.RetryAfter)
+}
+
+func (e *BusyError) Unwrap() error {
+	return ErrPeerBusy
+}
+
+// Retourne l'erreur d'un contexte annulé. Un délai dépassé satisfait
+// aussi errors.Is(err, ErrTimeout).
+func contextError(ctx context.Context) error {
+	err := ctx.Err()
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	return err
+}
+
+// Indique si l'erreur est un délai dépassé, y compris celui d'une
+// connexion ou d'un contexte.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, ErrTimeout) || errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// Retourne l'erreur d'une opération pour laquelle aucun noeud n'a
+// répondu. Si des requêtes ont dépassé leur délai, l'erreur satisfait
+// aussi errors.Is(err, ErrTimeout).
+func noPeersError(timedOut bool) error {
+	if timedOut {
+		return fmt.Errorf("%w: %w", ErrNoPeers, ErrTimeout)
+	}
+	return ErrNoPeers
+}
@@ -0,0 +1,175 @@
+package core
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Type d'un événement publié par un Host.
+type EventType int
+
+const (
+	PeerAddedEvent       EventType = iota // un noeud a été ajouté à la table de routage
+	PeerRemovedEvent                      // un noeud a été retiré de la table de routage
+	PeerReplacedEvent                     // un noeud retiré a été remplacé par un noeud du cache de remplaçants
+	ValueStoredEvent                      // une valeur a été stockée à la demande d'un noeud
+	ValueExpiredEvent                     // une valeur a expiré dans le stockage
+	ValueEvictedEvent                     // une valeur a été retirée du stockage avant son expiration
+	RequestReceivedEvent                  // une requête a été reçue
+	LookupCompletedEvent                  // une recherche itérative s'est terminée
+)
+
+func (t EventType) String() string {
+	switch t {
+	case PeerAddedEvent:
+		return "peer added"
+	case PeerRemovedEvent:
+		return "peer removed"
+	case PeerReplacedEvent:
+		return "peer replaced"
+	case ValueStoredEvent:
+		return "value stored"
+	case ValueExpiredEvent:
+		return "value expired"
+	case ValueEvictedEvent:
+		return "value evicted"
+	case RequestReceivedEvent:
+		return "request received"
+	case LookupCompletedEvent:
+		return "lookup completed"
+	default:
+		return "unknown"
+	}
+}
+
+// Event décrit ce que vient de faire un Host. Seuls les champs utiles à
+// son type sont renseignés.
+type Event struct {
+	Type EventType
+	Time time.Time
+
+	// Noeud ajouté, retiré ou promu, émetteur d'une requête ou d'une
+	// valeur stockée.
+	Peer Peer
+	// Noeud retiré, pour PeerReplacedEvent.
+	Replaced Peer
+
+	// Identifiant de la valeur, ou cible de la recherche.
+	Id Id
+
+	// Type de la requête, pour RequestReceivedEvent.
+	RequestType int
+
+	// Pour LookupCompletedEvent : noeuds les plus proches ayant répondu,
+	// si la valeur a été trouvée, durée de la recherche et nombre de
+	// sauts jusqu'au noeud le plus éloigné ayant répondu.
+	Peers    []Peer
+	Found    bool
+	Duration time.Duration
+	Hops     int
+}
+
+// Subscription reçoit les événements d'un Host. Les événements sont
+// délivrés sans jamais bloquer le noeud : si le canal est plein, ils
+// sont perdus et comptés par Dropped.
+type Subscription struct {
+	bus     *eventBus
+	events  chan Event
+	types   uint64 // masque des types reçus, 0 pour tous
+	dropped atomic.Uint64
+}
+
+// Retourne le canal des événements. Il est fermé par Close.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Retourne le nombre d'événements perdus car le canal était plein.
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Arrête la réception des événements et ferme le canal.
+func (s *Subscription) Close() {
+	s.bus.unsubscribe(s)
+}
+
+func (s *Subscription) accepts(t EventType) bool {
+	return s.types == 0 || s.types&(1<<t) != 0
+}
+
+// eventBus distribue les événements d'un Host à ses abonnés. observer
+// reçoit tous les événements avant les abonnés et ne doit pas bloquer.
+// eventBus est sûr pour une utilisation concurrente.
+type eventBus struct {
+	mu       sync.Mutex
+	subs     map[*Subscription]struct{}
+	observer func(Event)
+}
+
+func newEventBus(observer func(Event)) *eventBus {
+	return &eventBus{
+		subs:     make(map[*Subscription]struct{}),
+		observer: observer,
+	}
+}
+
+func (b *eventBus) subscribe(types []EventType) *Subscription {
+	s := &Subscription{
+		bus:    b,
+		events: make(chan Event, eventQueueSize),
+	}
+	for _, t := range types {
+		s.types |= 1 << t
+	}
+
+	b.mu.Lock()
+	b.subs[s] = struct{}{}
+	b.mu.Unlock()
+
+	return s
+}
+
+func (b *eventBus) unsubscribe(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subs[s]; ok {
+		delete(b.subs, s)
+		close(s.events)
+	}
+}
+
+// Délivre un événement aux abonnés concernés sans attendre.
+func (b *eventBus) publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	if b.observer != nil {
+		b.observer(e)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for s := range b.subs {
+		if !s.accepts(e.Type) {
+			continue
+		}
+
+		select {
+		case s.events <- e:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+// Abonne l'appelant aux événements du noeud des types donnés, ou à tous
+// les événements si aucun type n'est donné. Les événements sont perdus
+// si l'abonné ne les lit pas assez vite, voir Subscription.
+func (h *Host) Subscribe(types ...EventType) *Subscription {
+	return h.events.subscribe(types)
+}
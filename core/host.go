@@ -2,44 +2,178 @@ package core
 
 import (
 	"context"
-	"encoding/gob"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // Host est le noeud local.
 type Host struct {
-	id      Id
-	addr    string // l'adresse physique d'écoute
-	storage Storage
-
-	requests chan Request
-	listener net.Listener
+	id        Id                 // dérivé de la clé publique du noeud
+	key       ed25519.PrivateKey // clé du noeud, signe ses messages
+	addr      string             // l'adresse physique d'écoute
+	networkId string             // identifiant du réseau rejoint
+	storage   Storage
+	config    Config
+	configErr error // erreur de validation de la configuration, voir Start
+
+	// adresse à laquelle les autres noeuds joignent le noeud local,
+	// découverte auprès du noeud d'amorçage si discoverAddr
+	advertisedAddr string
+	discoverAddr   bool
+	advertisedMu   sync.Mutex
+
+	requests  requestQueue // requêtes reçues en attente des workers
+	transport Transport
+	listener  net.Listener
+	pool      *connPool
+
+	// requêtes légères par datagramme, si le transport le permet
+	datagrams     *datagramConn
+	datagramPeers map[string]datagramPeer // prise en charge des datagrammes par adresse
+	datagramsMu   sync.Mutex
 
 	rt routingTable
 
+	events  *eventBus
+	metrics *metrics
+
+	logger    *slog.Logger
+	logLevels map[string]slog.Leveler // niveaux propres aux composants
+	log       loggers
+
+	// valeurs publiées par le noeud local, republiées périodiquement
+	// jusqu'à leur expiration, voir Publish
+	published   map[Id]publishedValue
+	publishedMu sync.Mutex
+
+	// nouveaux noeuds en attente de transmission des valeurs, et
+	// parcours des valeurs locales autorisés par bucket
+	transfers     chan Peer
+	transferScans *rateLimiter
+
+	// noeuds les moins récemment vus en cours de vérification
+	checking   map[Id]struct{}
+	checkingMu sync.Mutex
+
+	// émetteurs en attente d'un ping-back avant d'être ajoutés
+	pending   pendingPeers
+	pendingMu sync.Mutex
+
+	// limites appliquées aux requêtes reçues
+	admission admission
+
+	// le noeud quitte le réseau et refuse les nouvelles valeurs, voir Leave
+	draining atomic.Bool
+
+	// noeuds surchargés et fin de leur suspension, par adresse
+	busy   map[string]time.Time
+	busyMu sync.Mutex
+
+	// Cycle de vie, voir Start et Run. ctx est recréé à chaque démarrage
+	// et annulé à l'arrêt, wg attend les processus de fond.
+	lifecycleMu sync.Mutex
+	running     bool
+	ready       chan struct{} // fermé lorsque le noeud accepte les connexions
+	failed      chan error    // erreur ayant interrompu l'acceptation des connexions
+
 	ctx    context.Context
 	cancel context.CancelFunc
 	wg     sync.WaitGroup
+	ctxMu  sync.Mutex // protège la création et l'annulation de ctx, voir goBackground
 }
 
-func NewHost(addr string, storage Storage) *Host {
-	id := NewRandomId()
+// Crée un noeud avec une nouvelle clé, et donc un nouvel identifiant.
+func NewHost(addr string, storage Storage, opts ...Option) *Host {
+	_, key, _ := ed25519.GenerateKey(nil)
+	return NewHostWithKey(key, addr, storage, opts...)
+}
+
+// Crée un noeud avec une nouvelle clé.
+//
+// Deprecated: l'identifiant d'un noeud est dérivé de sa clé et ne peut
+// plus être choisi, id est ignoré. Utiliser NewHostWithKey pour conserver
+// l'identifiant d'un noeud après un redémarrage.
+func NewHostWithId(id Id, addr string, storage Storage, opts ...Option) *Host {
+	return NewHost(addr, storage, opts...)
+}
+
+// Crée un noeud à partir de sa clé. Son identifiant est dérivé de la clé
+// publique, réutiliser la clé permet de conserver sa place dans le
+// réseau après un redémarrage.
+func NewHostWithKey(key ed25519.PrivateKey, addr string, storage Storage, opts ...Option) *Host {
+	id := IdFromPublicKey(key.Public().(ed25519.PublicKey))
+	// Le noeud est arrêté jusqu'à l'appel de Start.
 	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	h := &Host{
+		id:             id,
+		key:            key,
+		addr:           addr,
+		advertisedAddr: addr,
+		networkId:      DefaultNetworkId,
+		storage:        storage,
+		config:         DefaultConfig(),
+		transport:      NewTCPTransport(),
+		published:      make(map[Id]publishedValue),
+		transfers:      make(chan Peer, transferQueueSize),
+		transferScans:  newRateLimiter(transferScanLimit),
+		checking:       make(map[Id]struct{}),
+		pending:        newPendingPeers(),
+		busy:           make(map[string]time.Time),
+		datagramPeers:  make(map[string]datagramPeer),
+		metrics:        newMetrics(),
+		logger:         slog.New(slog.DiscardHandler),
+		logLevels:      make(map[string]slog.Leveler),
+		ready:          make(chan struct{}),
+		ctx:            ctx,
+		cancel:         cancel,
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
 
-	return &Host{
-		id:       id,
-		addr:     addr,
-		storage:  storage,
-		requests: make(chan Request, 1024),
-		rt:       *newRoutingTable(id),
-		ctx:      ctx,
-		cancel:   cancel,
+	// Un noeud dont la configuration est invalide ne peut pas être
+	// démarré et ses requêtes échouent. Il utilise la configuration par
+	// défaut pour que ses méthodes restent sûres.
+	if h.configErr = h.config.Validate(); h.configErr != nil {
+		h.config = DefaultConfig()
 	}
+
+	h.log = newLoggers(h.logger, h.logLevels)
+	h.admission = newAdmission(h.config)
+	h.events = newEventBus(h.metrics.observe)
+	h.rt = *newRoutingTable(id, h.config.BucketCapacity, h.config.ReplacementCacheSize)
+	h.pool = newConnPool(h.transport, h.clientHandshake, h.config)
+
+	if observable, ok := storage.(ObservableStorage); ok {
+		observable.Observe(h.events.publish)
+	}
+	if logging, ok := storage.(LoggingStorage); ok {
+		logging.SetLogger(h.log.storage)
+	}
+
+	return h
 }
 
+// Retourne l'adresse annoncée aux autres noeuds, par défaut l'adresse
+// d'écoute.
 func (h *Host) Addr() string {
+	h.advertisedMu.Lock()
+	defer h.advertisedMu.Unlock()
+
+	return h.advertisedAddr
+}
+
+// Retourne l'adresse d'écoute du noeud.
+func (h *Host) ListenAddr() string {
 	return h.addr
 }
 
@@ -52,113 +186,549 @@ func (h *Host) KnownPeerCount() int {
 }
 
 // Connecte le noeud local à un réseau à partir d'un noeud
-// distant y appartenant.
+// distant y appartenant. Avec WithAddrDiscovery, l'adresse annoncée est
+// d'abord demandée à ce noeud.
 func (h *Host) Bootstrap(addr string) error {
-	id, err := h.pingPeer(addr)
+	return h.BootstrapContext(context.Background(), addr)
+}
+
+// Comme Bootstrap, mais l'amorçage est abandonné à l'annulation de ctx.
+// Les noeuds découverts avant l'annulation restent dans la table de
+// routage.
+func (h *Host) BootstrapContext(ctx context.Context, addr string) error {
+	id, err := h.pingPeer(ctx, addr)
 	if err != nil {
 		return err
 	}
 
-	h.rt.addPeer(Peer{
+	if h.discoverAddr {
+		if err := h.discoverAdvertisedAddr(ctx, addr); err != nil {
+			return err
+		}
+	}
+
+	h.addPeer(Peer{
 		Id:   id,
 		Addr: addr,
 	})
 
-	h.FindNode(h.id)
+	h.FindNodeContext(ctx, h.id)
+	h.refreshBuckets(ctx, time.Now())
 
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	h.log.host.Info("bootstrapped", "bootstrap", addr, "peers", h.KnownPeerCount())
 	return nil
 }
 
-// Écoute et répond aux autres noeuds du réseau.
+// Écoute et répond aux autres noeuds du réseau. Start retourne une fois
+// que le noeud accepte les connexions, voir Ready. Un noeud arrêté par
+// Stop peut être redémarré, il conserve alors sa table de routage et
+// ses valeurs. Retourne une erreur si la configuration du noeud est
+// invalide, si le noeud est déjà démarré ou si l'adresse d'écoute est
+// indisponible.
 func (h *Host) Start() error {
+	h.lifecycleMu.Lock()
+	defer h.lifecycleMu.Unlock()
+
+	if h.running {
+		return ErrHostRunning
+	}
+
+	if h.configErr != nil {
+		return h.configErr
+	}
+
+	h.ctxMu.Lock()
+	h.ctx, h.cancel = context.WithCancel(context.Background())
+	h.ctxMu.Unlock()
+	h.failed = make(chan error, 1)
+	h.requests = newRequestQueue(h.config.RequestQueueSize)
+	h.draining.Store(false)
+
+	if err := h.listen(); err != nil {
+		h.stopBackground()
+		return err
+	}
+	h.running = true
+
+	h.startWorkers()
+
 	h.startCleanup()
-	return h.listen()
+	h.startPoolCleanup()
+	h.startStorageCleanup()
+	h.startAdmissionCleanup()
+	h.startRefresh()
+	h.startRepublish()
+	h.startTransfer()
+	h.startAccept(h.listener)
+
+	<-h.ready
+
+	h.log.host.Info("listening", "id", h.id, "addr", h.addr, "advertised", h.Addr())
+	return nil
 }
 
+// Arrête le noeud et attend la fin de ses processus de fond. Le noeud
+// peut ensuite être redémarré par Start.
 func (h *Host) Stop() {
-	if h.listener != nil {
-		h.cancel()
-		h.listener.Close()
-		h.listener = nil
-		h.wg.Wait()
+	h.lifecycleMu.Lock()
+	defer h.lifecycleMu.Unlock()
+
+	if !h.running {
+		return
 	}
+	h.running = false
+
+	h.stopBackground()
+	h.listener.Close()
+	h.listener = nil
+	h.wg.Wait()
+
+	h.pool.close()
+
+	h.datagramsMu.Lock()
+	if h.datagrams != nil {
+		h.datagrams.close()
+		h.datagrams = nil
+	}
+	h.datagramsMu.Unlock()
+
+	h.ready = make(chan struct{})
+
+	h.log.host.Info("stopped")
+}
+
+// Démarre le noeud et le fait fonctionner jusqu'à l'annulation de ctx,
+// puis l'arrête. Retourne l'erreur de démarrage, ou l'erreur ayant
+// interrompu l'acceptation des connexions. Retourne nil si le noeud a
+// été arrêté par ctx, Stop ou Leave.
+func (h *Host) Run(ctx context.Context) error {
+	if err := h.Start(); err != nil {
+		return err
+	}
+
+	h.lifecycleMu.Lock()
+	stopped, failed := h.ctx.Done(), h.failed
+	h.lifecycleMu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		h.Stop()
+		return nil
+	case err := <-failed:
+		h.Stop()
+		return err
+	case <-stopped:
+		return nil
+	}
+}
+
+// Lance fn en arrière-plan avec le contexte du noeud. Retourne false
+// sans lancer fn si le noeud n'est pas démarré, par exemple pour un
+// noeud utilisé sans appel à Start.
+func (h *Host) goBackground(fn func(ctx context.Context)) bool {
+	h.ctxMu.Lock()
+	defer h.ctxMu.Unlock()
+
+	ctx := h.ctx
+	if ctx.Err() != nil {
+		return false
+	}
+
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		fn(ctx)
+	}()
+
+	return true
+}
+
+// Annule le contexte du noeud. Aucun processus n'est ensuite lancé par
+// goBackground, wg peut donc être attendu.
+func (h *Host) stopBackground() {
+	h.ctxMu.Lock()
+	defer h.ctxMu.Unlock()
+
+	h.cancel()
+}
+
+// Retourne un canal fermé dès que le noeud accepte les connexions. Le
+// canal retourné après un arrêt est fermé au démarrage suivant.
+func (h *Host) Ready() <-chan struct{} {
+	h.lifecycleMu.Lock()
+	defer h.lifecycleMu.Unlock()
+
+	return h.ready
 }
 
 func (h *Host) listen() error {
-	listener, err := net.Listen("tcp", h.addr)
+	listener, err := h.transport.Listen(h.addr)
 	if err != nil {
 		return err
 	}
 
 	h.listener = listener
+	h.admission.inbound = make(chan struct{}, h.config.MaxInboundConns)
+
+	if pt, ok := h.transport.(PacketTransport); ok {
+		conn, err := pt.ListenPacket(h.addr)
+		if err != nil {
+			listener.Close()
+			h.listener = nil
+			return err
+		}
+
+		h.datagramsMu.Lock()
+		if h.datagrams != nil {
+			h.datagrams.close()
+		}
+		h.datagrams = newDatagramConn(h.meterPacketConn(conn), pt, networkTag(h.networkId), h.minVersion(), h.handleDatagram)
+		h.datagramsMu.Unlock()
+	}
+
+	return nil
+}
 
+// Accepte les connexions entrantes jusqu'à l'arrêt du noeud. Après un
+// échec, l'acceptation reprend après un délai doublant à chaque échec
+// consécutif. Si le listener est fermé alors que le noeud est démarré,
+// l'erreur est transmise à Run.
+func (h *Host) startAccept(listener net.Listener) {
 	h.wg.Add(1)
 	go func() {
 		defer h.wg.Done()
 
+		close(h.ready)
+
+		var delay time.Duration
 		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if h.ctx.Err() != nil {
+					return
+				}
+
+				if errors.Is(err, net.ErrClosed) {
+					h.log.host.Error("listener closed", "err", err)
+					h.failed <- fmt.Errorf("accept: %w", err)
+					return
+				}
+
+				delay = min(max(2*delay, minAcceptDelay), maxAcceptDelay)
+				h.log.host.Warn("accept failed", "err", err, "retryIn", delay)
+
+				select {
+				case <-time.After(delay):
+				case <-h.ctx.Done():
+					return
+				}
+				continue
+			}
+			delay = 0
+
 			select {
-			case <-h.ctx.Done():
-				return
+			case h.admission.inbound <- struct{}{}:
+				h.wg.Add(1)
+				go h.handleConn(conn)
 			default:
-				if conn, err := listener.Accept(); err == nil {
-					h.wg.Add(1)
-					go h.handleConn(conn)
-				}
+				h.log.rpc.Warn("too many inbound connections", "remote", conn.RemoteAddr().String())
+				h.metrics.observeRejected("conns", "")
+				conn.Close()
 			}
 		}
 	}()
-
-	return nil
 }
 
-func (h *Host) handleConn(conn net.Conn) {
+// Répond aux requêtes reçues sur une connexion jusqu'à sa fermeture
+// ou son inactivité pendant ConnIdleTtl. La connexion est fermée si le
+// noeud distant est incompatible, ou si une requête reçue sur une
+// connexion chiffrée n'a pas été émise par le noeud authentifié. Les
+// requêtes sont confiées aux workers, voir schedule, et leurs réponses
+// portent le même identifiant. Une requête refusée par le contrôle
+// d'admission reste sans réponse si le noeud distant est antérieur à
+// busyVersion.
+func (h *Host) handleConn(raw net.Conn) {
 	defer h.wg.Done()
-	defer conn.Close()
+	defer func() { <-h.admission.inbound }()
+	defer raw.Close()
+
+	stop := context.AfterFunc(h.ctx, func() { raw.Close() })
+	defer stop()
+
+	conn, session, err := h.serverHandshake(raw)
+	if err != nil {
+		h.log.rpc.Debug("handshake failed", "remote", raw.RemoteAddr().String(), "err", err)
+		return
+	}
+	codec := codecFor(session.version)
+
+	var writeMu sync.Mutex
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(h.config.ConnIdleTtl))
 
-	conn.SetDeadline(time.Now().Add(connTtl))
+		reqId, payload, err := readFrame(conn)
+		if err != nil {
+			return
+		}
+
+		req, err := codec.decodeRequest(payload)
+		if err != nil {
+			h.log.rpc.Warn("malformed request", "remote", raw.RemoteAddr().String(), "err", err)
+			return
+		}
+		if !session.accepts(req) {
+			h.log.rpc.Warn("request not sent by the authenticated peer",
+				"remote", raw.RemoteAddr().String(), "sender", req.SenderId, requestTypeAttr(req.Type))
+			return
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			res, err := h.schedule(req, raw.RemoteAddr())
+			if err != nil {
+				conn.Close()
+				return
+			}
 
-	var req Request
+			encoded, err := codec.encodeResponse(res)
+			if err != nil {
+				return
+			}
 
-	decoder := gob.NewDecoder(conn)
-	encoder := gob.NewEncoder(conn)
+			writeMu.Lock()
+			defer writeMu.Unlock()
 
-	if decoder.Decode(&req) == nil {
-		encoder.Encode(h.handleReq(req))
+			conn.SetWriteDeadline(time.Now().Add(h.config.ConnTtl))
+			writeFrame(conn, reqId, encoded)
+		}()
 	}
 }
 
-func (h *Host) handleReq(req Request) any {
-	if !req.SenderId.Equal(h.id) && req.SenderAddr != "" {
-		h.rt.addPeer(Peer{
-			Id:   req.SenderId,
-			Addr: req.SenderAddr,
-		})
+// Répond à une requête reçue par datagramme de from dans la version du
+// protocole donnée. La deuxième valeur de retour est false si la
+// réponse doit être demandée par connexion, car la requête ou sa
+// réponse contient une valeur. Les datagrammes ne sont pas chiffrés,
+// une requête non signée doit donc être envoyée par connexion, sauf
+// avec AllowInsecure.
+func (h *Host) handleDatagram(version uint16, payload []byte, from net.Addr) ([]byte, bool) {
+	codec := codecFor(version)
+
+	req, err := codec.decodeRequest(payload)
+	if err != nil || req.Type == StoreRequestType {
+		return nil, false
+	}
+
+	if !req.isSigned() && !h.config.AllowInsecure {
+		return nil, false
+	}
+
+	res, err := h.schedule(req, from)
+	if err != nil || res.Found {
+		return nil, false
 	}
 
+	encoded, err := codec.encodeResponse(res)
+	return encoded, err == nil
+}
+
+// Applique le contrôle d'admission à une requête reçue depuis l'adresse
+// observed, avant qu'elle n'attende un worker. Retourne true si la
+// requête est signée par son émetteur. Les requêtes non signées des
+// noeuds antérieurs à signedVersion sont admises, une requête dont la
+// signature est invalide est refusée avec errInvalidSignature. Une
+// requête dépassant le débit autorisé pour son adresse IP ou son
+// émetteur est refusée avec une *BusyError. L'émetteur d'une requête
+// non signée n'est pas prouvé, il est identifié par son adresse IP pour
+// les limites par émetteur, voir allowUnsigned.
+func (h *Host) admitReq(req Request, observed net.Addr) (bool, error) {
+	if retryAfter, ok := h.admission.allowIp(observed, req.Type); !ok {
+		h.log.rpc.Debug("request rate limited", "remote", observed, requestTypeAttr(req.Type), "retryAfter", retryAfter)
+		h.metrics.observeRejected("ip", requestTypeName(req.Type))
+		return false, &BusyError{RetryAfter: retryAfter}
+	}
+
+	verified := req.verify()
+	if req.isSigned() && !verified {
+		h.log.rpc.Warn("invalid request signature", "sender", req.SenderId, requestTypeAttr(req.Type))
+		return false, errInvalidSignature
+	}
+
+	if verified {
+		if retryAfter, ok := h.admission.allowPeer(req.SenderId, req.Type); !ok {
+			h.log.rpc.Debug("request rate limited", "sender", req.SenderId, requestTypeAttr(req.Type), "retryAfter", retryAfter)
+			h.metrics.observeRejected("peer", requestTypeName(req.Type))
+			return false, &BusyError{RetryAfter: retryAfter}
+		}
+	} else if retryAfter, ok := h.admission.allowUnsigned(observed, req.Type); !ok {
+		h.log.rpc.Debug("unsigned request rate limited", "remote", observed, requestTypeAttr(req.Type), "retryAfter", retryAfter)
+		h.metrics.observeRejected("peer", requestTypeName(req.Type))
+		return false, &BusyError{RetryAfter: retryAfter}
+	}
+
+	return verified, nil
+}
+
+// Répond à une requête admise reçue depuis l'adresse observed, voir
+// admitReq. verified indique si elle est signée par son émetteur. Seuls
+// les émetteurs ayant prouvé posséder leur identifiant et répondant à
+// l'adresse qu'ils annoncent sont ajoutés à la table de routage, voir
+// admitPeer.
+func (h *Host) handleReq(req Request, verified bool, observed net.Addr) Response {
+	sender := Peer{
+		Id:   req.SenderId,
+		Addr: req.SenderAddr,
+	}
+
+	if verified && req.SenderAddr != "" && req.Type != LeaveRequestType {
+		h.admitPeer(sender, observed)
+	}
+
+	h.log.rpc.Debug("request received", "sender", sender, requestTypeAttr(req.Type))
+	h.events.publish(Event{
+		Type:        RequestReceivedEvent,
+		Peer:        sender,
+		RequestType: req.Type,
+	})
+
+	res := Response{Type: req.Type}
+
 	switch req.Type {
 	case PingRequestType:
-		return h.id
+		res.Id = h.id
 
 	case FindNodeRequestType:
-		return h.closestPeersFrom(req.Id, bucketCapacity)
+		res.Peers = h.closestPeersFrom(req.Id, min(h.config.BucketCapacity, maxResponsePeers))
 
 	case FindValueRequestType:
-		res := findValueResponse{}
 		if val, ok := h.storage.Get(req.Id); ok {
 			res.Found = true
 			res.Value = val
 		} else {
-			res.Found = false
-			res.Nodes = h.closestPeersFrom(req.Id, bucketCapacity)
+			res.Peers = h.closestPeersFrom(req.Id, min(h.config.BucketCapacity, maxResponsePeers))
 		}
-		return res
 
 	case StoreRequestType:
-		return h.storage.Set(req.Id, req.Value)
+		if h.draining.Load() {
+			h.log.storage.Debug("store refused while draining", "sender", sender, "id", req.Id)
+			break
+		}
+
+		res.Ok = h.storage.Set(req.Id, req.Value)
+		if res.Ok {
+			h.events.publish(Event{Type: ValueStoredEvent, Peer: sender, Id: req.Id})
+		}
+
+	case ObservedAddrRequestType:
+		res.Addr = observedAddr(observed)
+
+	case LeaveRequestType:
+		if verified {
+			h.log.routing.Info("peer left", "peer", sender)
+			h.removePeer(sender.Id)
+		}
+	}
+
+	return h.signResponse(res, req)
+}
+
+// Ajoute un noeud à la table de routage. Si le noeud est nouveau, les
+// valeurs dont il fait désormais partie des plus proches lui sont
+// transmises. Si son bucket est plein, le noeud le moins récemment vu
+// du bucket est vérifié.
+func (h *Host) addPeer(peer Peer) bool {
+	if peer.Id.Equal(h.id) {
+		return false
+	}
+
+	if !h.rt.addPeer(peer) {
+		if lrs, ok := h.rt.evictionCandidate(peer.Id); ok {
+			h.checkPeer(lrs)
+		}
+		return false
+	}
+
+	h.log.routing.Debug("peer added", "peer", peer)
+	h.events.publish(Event{Type: PeerAddedEvent, Peer: peer})
+	h.scheduleTransfer(peer)
+	return true
+}
+
+// Retire un noeud de la table de routage et le remplace par un noeud
+// du cache de remplaçants.
+func (h *Host) removePeer(id Id) {
+	removed, ok := h.rt.removePeer(id)
+	if !ok {
+		return
+	}
+	h.forgetDatagramSupport(removed.Addr)
+
+	peer, ok := h.rt.promoteReplacement(id)
+	if !ok {
+		h.log.routing.Debug("peer removed", "peer", removed)
+		h.events.publish(Event{Type: PeerRemovedEvent, Peer: removed})
+		return
+	}
+
+	h.log.routing.Debug("peer replaced", "peer", removed, "replacement", peer)
+	h.events.publish(Event{Type: PeerReplacedEvent, Peer: peer, Replaced: removed})
+	h.scheduleTransfer(peer)
+}
+
+// Signale l'échec d'une requête vers un noeud. Il est retiré de la table
+// de routage après MaxPeerFailures échecs consécutifs. Un noeud surchargé
+// a répondu et n'est pas considéré en échec.
+func (h *Host) peerFailed(peer Peer, err error) {
+	if peer.Id.Equal(h.id) || errors.Is(err, ErrPeerBusy) {
+		return
+	}
+
+	if failures := h.rt.failPeer(peer.Id); failures >= h.config.MaxPeerFailures {
+		h.log.routing.Info("evicting failing peer", "peer", peer, "failures", failures)
+		h.removePeer(peer.Id)
+	}
+}
+
+// Vérifie qu'un noeud répond toujours. S'il ne répond pas, il est
+// retiré de la table de routage, sinon il est marqué comme récemment vu.
+// La vérification n'a lieu que si le noeud local est démarré, et un
+// ping interrompu par son arrêt ne retire pas le noeud.
+func (h *Host) checkPeer(peer Peer) {
+	h.checkingMu.Lock()
+	defer h.checkingMu.Unlock()
+
+	if _, ok := h.checking[peer.Id]; ok {
+		return
+	}
+
+	started := h.goBackground(func(ctx context.Context) {
+		id, err := h.pingPeer(ctx, peer.Addr)
+		if ctx.Err() != nil {
+			// Le noeud local s'arrête, l'état du noeud est inconnu.
+		} else if errors.Is(err, ErrPeerBusy) {
+			// Le noeud répond toujours, le nouveau noeud reste remplaçant.
+		} else if err != nil || !id.Equal(peer.Id) {
+			h.log.routing.Info("evicting least recently seen peer", "peer", peer, "err", err)
+			h.removePeer(peer.Id)
+		} else {
+			h.rt.addPeer(peer)
+		}
+
+		h.checkingMu.Lock()
+		delete(h.checking, peer.Id)
+		h.checkingMu.Unlock()
+	})
 
-	default:
-		return struct{}{}
+	if started {
+		h.checking[peer.Id] = struct{}{}
 	}
 }
 
@@ -173,7 +743,7 @@ func (h *Host) startCleanup() {
 	go func() {
 		defer h.wg.Done()
 
-		ticker := time.NewTicker(cleanupFreq)
+		ticker := time.NewTicker(h.config.CleanupFreq)
 		defer ticker.Stop()
 
 		for {
@@ -187,8 +757,181 @@ func (h *Host) startCleanup() {
 	}()
 }
 
+// Retire régulièrement les valeurs expirées du stockage, s'il est un
+// ExpiringStorage.
+func (h *Host) startStorageCleanup() {
+	storage, ok := h.storage.(ExpiringStorage)
+	if !ok {
+		return
+	}
+
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+
+		ticker := time.NewTicker(h.config.StorageTtl / 5)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				storage.RemoveExpired()
+			case <-h.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (h *Host) startPoolCleanup() {
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+
+		ticker := time.NewTicker(h.config.PoolIdleTtl / 2)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				h.pool.closeIdle()
+			case <-h.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Oublie régulièrement les limites de débit, les suspensions échues et
+// la prise en charge des datagrammes expirée.
+func (h *Host) startAdmissionCleanup() {
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+
+		ticker := time.NewTicker(admissionCleanupFreq)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				h.admission.prune()
+				h.transferScans.prune(time.Now())
+				h.pruneBusy()
+				h.pruneDatagramPeers()
+			case <-h.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (h *Host) startRefresh() {
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+
+		ticker := time.NewTicker(h.config.RefreshFreq)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				h.refreshBuckets(h.ctx, time.Now().Add(-h.config.RefreshFreq))
+			case <-h.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Recherche un identifiant aléatoire dans chaque bucket n'ayant pas
+// été parcouru par une recherche depuis since.
+func (h *Host) refreshBuckets(ctx context.Context, since time.Time) {
+	for _, i := range h.rt.staleBuckets(since) {
+		if ctx.Err() != nil {
+			return
+		}
+
+		h.FindNodeContext(ctx, h.rt.randomIdIn(i))
+	}
+}
+
+func (h *Host) startRepublish() {
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+
+		replicateTicker := time.NewTicker(h.config.ReplicateFreq)
+		defer replicateTicker.Stop()
+
+		republishTicker := time.NewTicker(h.config.RepublishFreq)
+		defer republishTicker.Stop()
+
+		for {
+			select {
+			case <-replicateTicker.C:
+				h.replicate()
+			case <-republishTicker.C:
+				h.republish()
+			case <-h.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Republie les valeurs détenues localement vers les noeuds les plus
+// proches de leur identifiant. Une valeur reçue depuis moins de
+// ReplicateFreq a déjà été republiée par un autre noeud et est ignorée.
+func (h *Host) replicate() {
+	threshold := time.Now().Add(h.config.StorageTtl - h.config.ReplicateFreq)
+
+	for id, expireAt := range h.storage.Keys() {
+		if h.ctx.Err() != nil {
+			return
+		}
+
+		if expireAt.After(threshold) {
+			continue
+		}
+
+		if value, ok := h.storage.Get(id); ok {
+			h.storeToClosest(h.ctx, id, value)
+		}
+	}
+}
+
+// Republie les valeurs publiées par le noeud local pour qu'elles
+// n'expirent pas. Les valeurs publiées depuis plus de PublishedTtl ne
+// sont plus republiées.
+func (h *Host) republish() {
+	now := time.Now()
+
+	h.publishedMu.Lock()
+	published := make(map[Id]Value, len(h.published))
+	for id, p := range h.published {
+		if now.After(p.expireAt) {
+			delete(h.published, id)
+			continue
+		}
+		published[id] = p.value
+	}
+	h.publishedMu.Unlock()
+
+	for id, value := range published {
+		if h.ctx.Err() != nil {
+			return
+		}
+
+		h.storeToClosest(h.ctx, id, value)
+	}
+}
+
 // Retire les noeuds ne répondant pas de la table de routage
 func (h *Host) cleanup() {
+	h.pruneVerified()
+
 	peers := h.rt.peers()
 
 	for _, peer := range peers {
@@ -197,15 +940,19 @@ func (h *Host) cleanup() {
 		go func() {
 			defer h.wg.Done()
 
-			id, err := h.pingPeer(peer.Addr)
+			id, err := h.pingPeer(h.ctx, peer.Addr)
 			if err != nil {
-				h.rt.removePeer(peer.Id)
+				if h.ctx.Err() == nil && !errors.Is(err, ErrPeerBusy) {
+					h.log.routing.Info("evicting unresponsive peer", "peer", peer, "err", err)
+					h.removePeer(peer.Id)
+				}
 				return
 			}
 
 			if id != peer.Id {
-				h.rt.removePeer(peer.Id)
-				h.rt.addPeer(Peer{
+				h.log.routing.Info("peer changed identity", "peer", peer, "id", id)
+				h.removePeer(peer.Id)
+				h.addPeer(Peer{
 					Id:   id,
 					Addr: peer.Addr,
 				})
@@ -0,0 +1,126 @@
+package core
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// Quitte le réseau puis arrête le noeud. Le noeud refuse les nouveaux
+// stockages, transmet chaque valeur détenue localement aux noeuds les
+// plus proches de son identifiant, puis informe les noeuds de sa table
+// de routage de son départ pour qu'ils le retirent aussitôt. Une valeur
+// n'est envoyée qu'aux noeuds ne la détenant pas encore, ce que le noeud
+// vérifie par un FIND_VALUE. À l'annulation de ctx, les
+// requêtes en cours sont abandonnées, le noeud est arrêté et l'erreur
+// de ctx est retournée.
+func (h *Host) Leave(ctx context.Context) error {
+	defer h.Stop()
+
+	h.draining.Store(true)
+
+	h.handOff(ctx)
+	h.notifyLeave(ctx)
+
+	if ctx.Err() != nil {
+		return contextError(ctx)
+	}
+	return nil
+}
+
+// Transmet les valeurs détenues localement aux noeuds les plus proches
+// de leur identifiant, drainConcurrency valeurs à la fois.
+func (h *Host) handOff(ctx context.Context) {
+	keys := h.storage.Keys()
+	h.log.host.Info("draining", "values", len(keys))
+
+	sem := make(chan struct{}, drainConcurrency)
+	var wg sync.WaitGroup
+	var handed atomic.Int64
+
+loop:
+	for id := range keys {
+		value, ok := h.storage.Get(id)
+		if !ok {
+			continue
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			break loop
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if h.handOffValue(ctx, id, value) > 0 {
+				handed.Add(1)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if n := handed.Load(); n < int64(len(keys)) {
+		h.log.host.Warn("values not handed off", "handed", n, "values", len(keys))
+	} else {
+		h.log.host.Info("values handed off", "values", n)
+	}
+}
+
+// Transmet une valeur aux noeuds les plus proches de son identifiant, à
+// l'exception du noeud local, jusqu'à ce que MaxReplicasCount d'entre eux
+// la détiennent. Un noeud détenant déjà la valeur ne la reçoit pas.
+// Retourne le nombre de noeuds détenant la valeur.
+func (h *Host) handOffValue(ctx context.Context, id Id, value Value) int {
+	peers, _ := h.findNode(ctx, id)
+	replicas := 0
+
+	for _, peer := range peers {
+		if replicas >= h.config.MaxReplicasCount || ctx.Err() != nil {
+			break
+		}
+		if peer.Id.Equal(h.id) {
+			continue
+		}
+
+		res, _, err := h.findValueFrom(ctx, peer, id)
+		if err != nil {
+			h.peerFailed(peer, err)
+			continue
+		}
+		if res.Found {
+			replicas++
+			continue
+		}
+
+		ok, err := h.storeTo(ctx, peer, id, value)
+		if err != nil {
+			h.peerFailed(peer, err)
+			continue
+		}
+		if ok {
+			replicas++
+		}
+	}
+
+	return replicas
+}
+
+// Informe les noeuds de la table de routage du départ du noeud local.
+func (h *Host) notifyLeave(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for _, peer := range h.rt.peers() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.leaveTo(ctx, peer)
+		}()
+	}
+
+	wg.Wait()
+}
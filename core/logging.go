@@ -0,0 +1,89 @@
+package core
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Composants journalisés par un Host, chacun avec son propre niveau,
+// voir WithLogLevel. Chaque enregistrement porte l'attribut component.
+const (
+	HostComponent    = "host"    // démarrage, amorçage et adresse annoncée
+	RoutingComponent = "routing" // table de routage
+	RpcComponent     = "rpc"     // requêtes envoyées et reçues, poignées de main
+	StorageComponent = "storage" // stockage local
+)
+
+// Liste des composants journalisés par un Host.
+var LogComponents = []string{HostComponent, RoutingComponent, RpcComponent, StorageComponent}
+
+// Un LoggingStorage est un Storage qui journalise ses opérations. Un
+// Host lui transmet le journal du composant StorageComponent.
+type LoggingStorage interface {
+	Storage
+	SetLogger(logger *slog.Logger)
+}
+
+// Journaux des composants d'un Host.
+type loggers struct {
+	host    *slog.Logger
+	routing *slog.Logger
+	rpc     *slog.Logger
+	storage *slog.Logger
+}
+
+// Crée les journaux des composants à partir du journal du noeud. Un
+// composant sans niveau propre utilise celui du journal du noeud.
+func newLoggers(logger *slog.Logger, levels map[string]slog.Leveler) loggers {
+	component := func(name string) *slog.Logger {
+		handler := logger.Handler()
+		if level, ok := levels[name]; ok {
+			handler = levelHandler{Handler: handler, level: level}
+		}
+		return slog.New(handler).With("component", name)
+	}
+
+	return loggers{
+		host:    component(HostComponent),
+		routing: component(RoutingComponent),
+		rpc:     component(RpcComponent),
+		storage: component(StorageComponent),
+	}
+}
+
+// levelHandler ignore les enregistrements sous le niveau d'un composant.
+// Le Handler sous-jacent doit accepter ce niveau.
+type levelHandler struct {
+	slog.Handler
+	level slog.Leveler
+}
+
+func (h levelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level.Level() && h.Handler.Enabled(ctx, level)
+}
+
+func (h levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return levelHandler{Handler: h.Handler.WithAttrs(attrs), level: h.level}
+}
+
+func (h levelHandler) WithGroup(name string) slog.Handler {
+	return levelHandler{Handler: h.Handler.WithGroup(name), level: h.level}
+}
+
+// Journalise un identifiant sous sa forme hexadécimale.
+func (id Id) LogValue() slog.Value {
+	return slog.StringValue(id.String())
+}
+
+// Journalise un noeud par son identifiant et son adresse.
+func (p Peer) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("id", p.Id.String()),
+		slog.String("addr", p.Addr),
+	)
+}
+
+// Retourne l'attribut du type d'une requête.
+func requestTypeAttr(reqType int) slog.Attr {
+	return slog.String("type", requestTypeName(reqType))
+}
@@ -0,0 +1,171 @@
+package core
+
+import (
+	"context"
+	"time"
+)
+
+// État d'un noeud au cours d'une recherche itérative.
+type lookupState int
+
+const (
+	lookupPending lookupState = iota // pas encore interrogé
+	lookupInFlight
+	lookupAnswered
+	lookupFailed
+)
+
+// lookupResult est la réponse d'un noeud interrogé lors d'une recherche.
+type lookupResult struct {
+	peer  Peer
+	peers []Peer // noeuds plus proches de la cible connus du noeud
+	value Value
+	found bool // true si le noeud a retourné la valeur recherchée
+
+	// true si le noeud a prouvé son identité, seuls ces noeuds sont
+	// ajoutés à la table de routage
+	verified bool
+
+	err error
+}
+
+// Interroge un noeud au cours d'une recherche.
+type lookupQuery func(peer Peer) lookupResult
+
+// Recherche itérative des noeuds les plus proches de target. Jusqu'à
+// BatchSize noeuds sont interrogés simultanément, et un nouveau noeud
+// est interrogé dès qu'une réponse arrive. La recherche se termine
+// lorsque les BucketCapacity noeuds les plus proches rencontrés ont
+// tous répondu, ou dès qu'un noeud retourne une valeur. Les noeuds
+// ayant répondu sont retournés par distance croissante. Les noeuds
+// découverts ne sont ajoutés à la table de routage qu'une fois qu'ils
+// ont répondu et prouvé leur identité. À l'annulation de ctx, aucun
+// nouveau noeud n'est interrogé et les noeuds ayant déjà répondu sont
+// retournés sans attendre les requêtes en cours. timedOut indique si au
+// moins une requête a dépassé son délai. LookupCompletedEvent est publié
+// à la fin de la recherche.
+func (h *Host) lookup(ctx context.Context, target Id, query lookupQuery) (closest []Peer, value Value, found bool, timedOut bool) {
+	h.rt.touchBucket(target)
+
+	start := time.Now()
+	hops := 0
+	defer func() {
+		h.events.publish(Event{
+			Type:     LookupCompletedEvent,
+			Id:       target,
+			Peers:    closest,
+			Found:    found,
+			Duration: time.Since(start),
+			Hops:     hops,
+		})
+	}()
+
+	shortlist := h.closestPeersFrom(target, h.config.BucketCapacity)
+	states := make(map[Id]lookupState)
+	depths := make(map[Id]int) // nombre de sauts depuis le noeud local
+	for _, peer := range shortlist {
+		states[peer.Id] = lookupPending
+		depths[peer.Id] = 1
+	}
+
+	// Le tampon permet aux requêtes encore en cours de se terminer
+	// lorsque la recherche s'arrête prématurément.
+	results := make(chan lookupResult, h.config.BatchSize)
+	inFlight := 0
+
+	for {
+		for inFlight < h.config.BatchSize && ctx.Err() == nil {
+			peer, ok := nextLookupPeer(shortlist, states, h.config.BucketCapacity)
+			if !ok {
+				break
+			}
+
+			states[peer.Id] = lookupInFlight
+			inFlight++
+
+			go func() {
+				res := query(peer)
+				res.peer = peer
+				results <- res
+			}()
+		}
+
+		if inFlight == 0 {
+			break
+		}
+
+		var res lookupResult
+		select {
+		case res = <-results:
+		case <-ctx.Done():
+			return h.lookupAnswered(shortlist, states), Value{}, false, timedOut
+		}
+		inFlight--
+
+		if res.err != nil {
+			states[res.peer.Id] = lookupFailed
+			timedOut = timedOut || isTimeout(res.err)
+			if ctx.Err() == nil {
+				h.peerFailed(res.peer, res.err)
+			}
+			continue
+		}
+
+		states[res.peer.Id] = lookupAnswered
+		hops = max(hops, depths[res.peer.Id])
+		if res.verified {
+			h.addPeer(res.peer)
+		}
+
+		if res.found {
+			return nil, res.value, true, timedOut
+		}
+
+		for _, peer := range res.peers {
+			if _, known := states[peer.Id]; !known {
+				states[peer.Id] = lookupPending
+				depths[peer.Id] = depths[res.peer.Id] + 1
+				shortlist = append(shortlist, peer)
+			}
+		}
+
+		sortPeersByDistance(shortlist, target)
+	}
+
+	return h.lookupAnswered(shortlist, states), Value{}, false, timedOut
+}
+
+// Retourne les BucketCapacity noeuds les plus proches ayant répondu.
+func (h *Host) lookupAnswered(shortlist []Peer, states map[Id]lookupState) []Peer {
+	closest := make([]Peer, 0, h.config.BucketCapacity)
+	for _, peer := range shortlist {
+		if states[peer.Id] == lookupAnswered {
+			closest = append(closest, peer)
+		}
+	}
+
+	return firstNPeers(closest, h.config.BucketCapacity)
+}
+
+// Retourne le prochain noeud à interroger parmi les n noeuds les plus
+// proches n'ayant pas échoué. La liste doit être triée par distance
+// croissante.
+func nextLookupPeer(shortlist []Peer, states map[Id]lookupState, n int) (Peer, bool) {
+	considered := 0
+
+	for _, peer := range shortlist {
+		switch states[peer.Id] {
+		case lookupFailed:
+			continue
+		case lookupPending:
+			return peer, true
+		}
+
+		considered++
+		if considered >= n {
+			break
+		}
+	}
+
+	return Peer{}, false
+}
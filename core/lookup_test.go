@@ -0,0 +1,65 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Crée un noeud arrêté connaissant count noeuds fictifs.
+func newLookupHost(count int) *Host {
+	h := NewHost("node-a", NewMemoryStorage(), WithTransport(NewMemoryTransport()))
+	for i := range count {
+		h.rt.addPeer(Peer{Id: NewRandomId(), Addr: fmt.Sprintf("node-%d", i)})
+	}
+	return h
+}
+
+func TestLookupConcurrency(t *testing.T) {
+	h := newLookupHost(50)
+
+	var inFlight, maxInFlight, queried atomic.Int32
+	closest, _, _, _ := h.lookup(context.Background(), NewRandomId(), func(peer Peer) lookupResult {
+		n := inFlight.Add(1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		inFlight.Add(-1)
+		queried.Add(1)
+
+		return lookupResult{}
+	})
+
+	if got := maxInFlight.Load(); got != int32(h.config.BatchSize) {
+		t.Fatalf("%d requêtes simultanées, %d attendues", got, h.config.BatchSize)
+	}
+
+	if len(closest) != h.config.BucketCapacity || queried.Load() != int32(h.config.BucketCapacity) {
+		t.Fatalf("%d noeuds interrogés et %d retournés, %d attendus", queried.Load(), len(closest), h.config.BucketCapacity)
+	}
+}
+
+func TestLookupStopsOnValue(t *testing.T) {
+	h := newLookupHost(50)
+
+	var queried atomic.Int32
+	_, value, found, _ := h.lookup(context.Background(), NewRandomId(), func(peer Peer) lookupResult {
+		queried.Add(1)
+		return lookupResult{value: Value{1}, found: true}
+	})
+
+	if !found || value != (Value{1}) {
+		t.Fatal("La valeur aurait dû être trouvée")
+	}
+
+	if n := queried.Load(); n > int32(h.config.BatchSize) {
+		t.Fatalf("%d noeuds interrogés après avoir trouvé la valeur, au plus %d attendus", n, h.config.BatchSize)
+	}
+}
@@ -1,8 +1,9 @@
 package core
 
 import (
-	"encoding/gob"
-	"net"
+	"context"
+	"crypto/ed25519"
+	"errors"
 	"time"
 )
 
@@ -12,22 +13,44 @@ const (
 	FindNodeRequestType
 	FindValueRequestType
 	StoreRequestType
+	ObservedAddrRequestType
+	LeaveRequestType
 )
 
-// Request est une requête envoyer d'un noeud à un autre. Elle
-// a une taille fixe pour tous les types de requête.
+// Request est une requête envoyée d'un noeud à un autre. Seuls les
+// champs utiles à son type sont transmis par binaryCodec.
 type Request struct {
 	Type       int
 	Id         Id
 	Value      Value
 	SenderAddr string
 	SenderId   Id
+
+	// Preuve que l'émetteur possède SenderId, voir Host.sign.
+	PublicKey [ed25519.PublicKeySize]byte
+	Timestamp int64 // date d'émission en secondes Unix
+	Signature [ed25519.SignatureSize]byte
 }
 
-type findValueResponse struct {
-	Found bool
-	Value Value
-	Nodes []Peer
+// Response est la réponse d'un noeud à une Request. Seuls les champs
+// correspondant au type de la requête sont renseignés.
+type Response struct {
+	Type  int    // type de la requête
+	Id    Id     // ping : identifiant du noeud
+	Peers []Peer // find node, ou find value si la valeur est absente
+	Found bool   // find value
+	Value Value  // find value si Found
+	Ok    bool   // store
+	Addr  string // observed addr : adresse depuis laquelle la requête a été reçue
+
+	// Le noeud est surchargé et refuse la requête, elle peut être
+	// renvoyée après RetryAfter. Les autres champs sont vides.
+	Busy       bool
+	RetryAfter time.Duration
+
+	// Preuve de l'identité du noeud qui répond, voir Host.signResponse.
+	PublicKey [ed25519.PublicKeySize]byte
+	Signature [ed25519.SignatureSize]byte
 }
 
 func newPingRequest() Request {
@@ -58,56 +81,169 @@ func newStoreRequest(id Id, value Value) Request {
 	}
 }
 
-func (r Request) sign(addr string, id Id) Request {
-	r.SenderAddr = addr
-	r.SenderId = id
-	return r
+func newObservedAddrRequest() Request {
+	return Request{
+		Type: ObservedAddrRequestType,
+	}
+}
+
+func newLeaveRequest() Request {
+	return Request{
+		Type: LeaveRequestType,
+	}
+}
+
+// Demande l'identifiant d'un noeud. Le noeud doit prouver qu'il
+// possède la clé associée à son identifiant.
+func (h *Host) pingPeer(ctx context.Context, addr string) (Id, error) {
+	req := h.sign(newPingRequest())
+
+	res, err := h.request(ctx, addr, req)
+	if err != nil {
+		return Id{}, err
+	}
+
+	id, ok := res.verify(req)
+	if !ok {
+		return Id{}, errUnverifiedPeer
+	}
+
+	return id, nil
+}
+
+// Demande au noeud[addr] l'adresse depuis laquelle il reçoit les
+// requêtes du noeud local. Le noeud doit prouver son identité.
+func (h *Host) observedAddrFrom(ctx context.Context, addr string) (string, error) {
+	req := h.sign(newObservedAddrRequest())
+
+	res, err := h.request(ctx, addr, req)
+	if err != nil {
+		return "", err
+	}
+
+	if _, ok := res.verify(req); !ok {
+		return "", errUnverifiedPeer
+	}
+
+	return res.Addr, nil
 }
 
-// Demande l'identifiant d'un noeud.
-func (h *Host) pingPeer(addr string) (Id, error) {
-	return requestTo[Id](addr, newPingRequest().sign(h.addr, h.id))
+// Informe le noeud que le noeud local quitte le réseau, pour qu'il le
+// retire de sa table de routage.
+func (h *Host) leaveTo(ctx context.Context, peer Peer) error {
+	_, _, err := h.requestPeer(ctx, peer, newLeaveRequest())
+	return err
 }
 
-// Demande les bucketCapacity noeuds les plus proches de target de la table
-// de routage du noeud[addr].
-func (h *Host) findNodeFrom(addr string, target Id) ([]Peer, error) {
-	req := newFindNodeRequest(target).sign(h.addr, h.id)
-	return requestTo[[]Peer](addr, req)
+// Demande les BucketCapacity noeuds les plus proches de target de la table
+// de routage du noeud. La deuxième valeur de retour indique si le noeud a
+// prouvé son identité.
+func (h *Host) findNodeFrom(ctx context.Context, peer Peer, target Id) ([]Peer, bool, error) {
+	res, verified, err := h.requestPeer(ctx, peer, newFindNodeRequest(target))
+	return res.Peers, verified, err
 }
 
-// Demande la valeur de clé target. Si le noeud[addr] ne l'a pas, il répond avec
-// les bucketCapacity noeuds les plus proches de target de sa table de routage.
-func (h *Host) findValueFrom(addr string, target Id) (findValueResponse, error) {
-	req := newFindValueRequest(target).sign(h.addr, h.id)
-	return requestTo[findValueResponse](addr, req)
+// Demande la valeur de clé target. Si le noeud ne l'a pas, il répond avec
+// les BucketCapacity noeuds les plus proches de target de sa table de
+// routage. La deuxième valeur de retour indique si le noeud a prouvé son
+// identité.
+func (h *Host) findValueFrom(ctx context.Context, peer Peer, target Id) (Response, bool, error) {
+	return h.requestPeer(ctx, peer, newFindValueRequest(target))
 }
 
-// Demande à stocker la pair key-value sur le noeud[addr].
-func (h *Host) storeTo(addr string, key Id, value Value) (bool, error) {
-	req := newStoreRequest(key, value).sign(h.addr, h.id)
-	return requestTo[bool](addr, req)
+// Demande à stocker la pair key-value sur le noeud. Si la réponse est
+// signée par un autre noeud, le stockage échoue.
+func (h *Host) storeTo(ctx context.Context, peer Peer, key Id, value Value) (bool, error) {
+	res, _, err := h.requestPeer(ctx, peer, newStoreRequest(key, value))
+	return res.Ok, err
 }
 
-func requestTo[R any](addr string, req Request) (R, error) {
-	var ret R
+// Envoie une requête signée au noeud et vérifie l'identité du noeud qui
+// répond. La deuxième valeur de retour est false si la réponse n'est pas
+// signée, ce qui est le cas des noeuds antérieurs à signedVersion. Si la
+// réponse est signée par un autre noeud que celui attendu, la requête
+// échoue.
+func (h *Host) requestPeer(ctx context.Context, peer Peer, req Request) (Response, bool, error) {
+	req = h.sign(req)
 
-	conn, err := net.Dial("tcp", addr)
+	res, err := h.request(ctx, peer.Addr, req)
 	if err != nil {
-		return ret, err
+		return Response{}, false, err
 	}
-	defer conn.Close()
 
-	conn.SetDeadline(time.Now().Add(connTtl))
+	id, verified := res.verify(req)
+	if verified && !id.Equal(peer.Id) {
+		return Response{}, false, errUnexpectedPeer
+	}
 
-	encoder := gob.NewEncoder(conn)
-	decoder := gob.NewDecoder(conn)
+	return res, verified, nil
+}
 
-	if encoder.Encode(req) != nil {
-		return ret, err
+// Envoie une requête au noeud[addr] et retourne sa réponse.
+// Si le transport le permet, les requêtes ne contenant pas de valeur
+// sont envoyées par datagramme aux noeuds qui y répondent, sauf LEAVE
+// que seuls les noeuds l'annonçant lors de la poignée de main prennent
+// en charge. La requête
+// est envoyée par connexion si sa réponse est trop grande ou contient
+// une valeur, ou si le noeud ne répond pas aux datagrammes. La requête
+// est abandonnée à l'annulation de ctx. Une réponse busy fait échouer la
+// requête avec une BusyError. Si elle a été reçue sur une connexion
+// chiffrée, les requêtes vers le noeud échouent ensuite sans être
+// envoyées jusqu'à la fin du délai demandé, d'au plus maxBusyBackoff.
+// Une réponse busy n'étant pas signée, celle reçue par datagramme ou
+// sur une connexion non chiffrée pourrait avoir été forgée et ne
+// suspend pas les requêtes. Les requêtes d'un noeud dont la
+// configuration est invalide échouent avec ErrInvalidConfig.
+func (h *Host) request(ctx context.Context, addr string, req Request) (Response, error) {
+	if h.configErr != nil {
+		return Response{}, h.configErr
 	}
 
-	err = decoder.Decode(&ret)
+	if wait, ok := h.backingOff(addr); ok {
+		return Response{}, &BusyError{Addr: addr, RetryAfter: wait}
+	}
+
+	start := time.Now()
+	res, authenticated, err := h.send(ctx, addr, req)
+	if err == nil && res.Busy {
+		retryAfter := min(res.RetryAfter, maxBusyBackoff)
+		if authenticated {
+			h.backOff(addr, retryAfter)
+		}
+		res, err = Response{}, &BusyError{Addr: addr, RetryAfter: retryAfter}
+	}
+	h.metrics.observeRequest(req.Type, err, time.Since(start))
+
+	if err != nil && ctx.Err() == nil {
+		h.log.rpc.Debug("request failed", "addr", addr, requestTypeAttr(req.Type), "err", err)
+	}
+
+	return res, err
+}
+
+// Envoie une requête sans la compter dans les métriques, voir request.
+// La deuxième valeur de retour indique si la réponse a été reçue sur
+// une connexion chiffrée. Les datagrammes n'étant pas chiffrés, une
+// réponse par datagramme non signée par le noeud qui répond est ignorée
+// et la requête est envoyée par connexion, sauf avec AllowInsecure.
+func (h *Host) send(ctx context.Context, addr string, req Request) (Response, bool, error) {
+	if req.Type != StoreRequestType && req.Type != LeaveRequestType {
+		if dc := h.datagramConn(); dc != nil && h.acceptsDatagrams(dc, addr) {
+			res, err := requestDatagram(ctx, dc, addr, req)
+			if err == nil && !res.Busy && !h.config.AllowInsecure {
+				if _, ok := res.verify(req); !ok {
+					res, err = Response{}, errUnverifiedPeer
+				}
+			}
+			if err == nil || ctx.Err() != nil {
+				return res, false, err
+			}
+
+			if errors.Is(err, ErrTimeout) {
+				h.setDatagramSupport(addr, datagramUnsupported)
+			}
+		}
+	}
 
-	return ret, err
+	return h.pool.request(ctx, addr, req)
 }
@@ -0,0 +1,353 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Bornes des histogrammes.
+var (
+	latencyBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5}
+	hopsBuckets    = []float64{1, 2, 3, 4, 5, 6, 8, 10, 15, 20}
+)
+
+// metrics regroupe les compteurs et les histogrammes d'un Host. Les
+// événements du noeud y sont comptés au fil de leur publication.
+// metrics est sûr pour une utilisation concurrente.
+type metrics struct {
+	rpcs       counterVec   // requêtes envoyées, par type et résultat
+	rpcLatency histogramVec // durée des requêtes envoyées, par type
+	received   counterVec   // requêtes reçues, par type
+
+	lookups        counterVec // recherches, selon que la valeur a été trouvée
+	lookupHops     histogramVec
+	lookupDuration histogramVec
+
+	rejected counterVec // requêtes et connexions refusées par le contrôle d'admission
+
+	routing counterVec // modifications de la table de routage
+	storage counterVec // valeurs stockées et retirées du stockage
+
+	bytesIn  atomic.Uint64
+	bytesOut atomic.Uint64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		rpcs:           newCounterVec(),
+		rpcLatency:     newHistogramVec(latencyBuckets),
+		received:       newCounterVec(),
+		rejected:       newCounterVec(),
+		lookups:        newCounterVec(),
+		lookupHops:     newHistogramVec(hopsBuckets),
+		lookupDuration: newHistogramVec(latencyBuckets),
+		routing:        newCounterVec(),
+		storage:        newCounterVec(),
+	}
+}
+
+// Compte une requête envoyée, son résultat et sa durée.
+func (m *metrics) observeRequest(reqType int, err error, duration time.Duration) {
+	name := requestTypeName(reqType)
+	m.rpcs.inc(labels("type", name, "outcome", requestOutcome(err)))
+	m.rpcLatency.observe(labels("type", name), duration.Seconds())
+}
+
+// Compte une connexion ou une requête refusée par le contrôle
+// d'admission. reqType est vide pour une connexion.
+func (m *metrics) observeRejected(reason, reqType string) {
+	if reqType == "" {
+		m.rejected.inc(labels("reason", reason))
+		return
+	}
+	m.rejected.inc(labels("reason", reason, "type", reqType))
+}
+
+// Compte un événement du noeud.
+func (m *metrics) observe(e Event) {
+	switch e.Type {
+	case PeerAddedEvent:
+		m.routing.inc(labels("change", "added"))
+	case PeerRemovedEvent:
+		m.routing.inc(labels("change", "removed"))
+	case PeerReplacedEvent:
+		m.routing.inc(labels("change", "replaced"))
+	case ValueStoredEvent:
+		m.storage.inc(labels("change", "stored"))
+	case ValueExpiredEvent:
+		m.storage.inc(labels("change", "expired"))
+	case ValueEvictedEvent:
+		m.storage.inc(labels("change", "evicted"))
+	case RequestReceivedEvent:
+		m.received.inc(labels("type", requestTypeName(e.RequestType)))
+	case LookupCompletedEvent:
+		found := labels("found", strconv.FormatBool(e.Found))
+		m.lookups.inc(found)
+		m.lookupHops.observe(found, float64(e.Hops))
+		m.lookupDuration.observe(found, e.Duration.Seconds())
+	}
+}
+
+func requestTypeName(reqType int) string {
+	switch reqType {
+	case PingRequestType:
+		return "ping"
+	case FindNodeRequestType:
+		return "find_node"
+	case FindValueRequestType:
+		return "find_value"
+	case StoreRequestType:
+		return "store"
+	case ObservedAddrRequestType:
+		return "observed_addr"
+	case LeaveRequestType:
+		return "leave"
+	default:
+		return "unknown"
+	}
+}
+
+func requestOutcome(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case isTimeout(err):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, ErrPeerBusy):
+		return "busy"
+	default:
+		return "error"
+	}
+}
+
+// Écrit les métriques du noeud au format texte de Prometheus.
+func (h *Host) WriteMetrics(w io.Writer) error {
+	m := h.metrics
+	mw := &metricWriter{w: w}
+
+	mw.counterVec("gdfs_rpc_requests_total", "Requests sent to other nodes, by type and outcome.", m.rpcs)
+	mw.histogramVec("gdfs_rpc_duration_seconds", "Duration of requests sent to other nodes, by type.", m.rpcLatency)
+	mw.counterVec("gdfs_rpc_received_total", "Requests received from other nodes, by type.", m.received)
+	mw.counterVec("gdfs_rpc_rejected_total", "Inbound connections and requests rejected by admission control.", m.rejected)
+	mw.header("gdfs_rpc_queue_depth", "gauge", "Inbound requests waiting for a worker, by priority.")
+	for p := range requestPriority(priorityCount) {
+		mw.sample("gdfs_rpc_queue_depth", labels("priority", p.String()), float64(h.requests.len(p)))
+	}
+
+	mw.counterVec("gdfs_lookups_total", "Iterative lookups, by whether the value was found.", m.lookups)
+	mw.histogramVec("gdfs_lookup_hops", "Hops of iterative lookups.", m.lookupHops)
+	mw.histogramVec("gdfs_lookup_duration_seconds", "Duration of iterative lookups.", m.lookupDuration)
+
+	mw.header("gdfs_transport_bytes_total", "counter", "Bytes exchanged with other nodes.")
+	mw.sample("gdfs_transport_bytes_total", labels("direction", "in"), float64(m.bytesIn.Load()))
+	mw.sample("gdfs_transport_bytes_total", labels("direction", "out"), float64(m.bytesOut.Load()))
+
+	mw.counterVec("gdfs_routing_changes_total", "Changes of the routing table.", m.routing)
+	mw.header("gdfs_routing_peers", "gauge", "Peers in the routing table.")
+	mw.sample("gdfs_routing_peers", "", float64(h.KnownPeerCount()))
+
+	mw.counterVec("gdfs_storage_changes_total", "Values stored, expired or evicted from local storage.", m.storage)
+	mw.header("gdfs_storage_values", "gauge", "Values in local storage.")
+	mw.sample("gdfs_storage_values", "", float64(storageLen(h.storage)))
+
+	return mw.err
+}
+
+// Retourne le nombre de valeurs détenues par un Storage.
+func storageLen(storage Storage) int {
+	if s, ok := storage.(interface{ Len() int }); ok {
+		return s.Len()
+	}
+	return len(storage.Keys())
+}
+
+// Retourne des étiquettes au format Prometheus à partir de paires
+// nom-valeur.
+func labels(pairs ...string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=%q", pairs[i], pairs[i+1])
+	}
+	return b.String()
+}
+
+// counterVec est un ensemble de compteurs indexés par leurs étiquettes.
+type counterVec struct {
+	mu     *sync.Mutex
+	values map[string]uint64
+}
+
+func newCounterVec() counterVec {
+	return counterVec{mu: &sync.Mutex{}, values: make(map[string]uint64)}
+}
+
+func (c counterVec) inc(labels string) {
+	c.mu.Lock()
+	c.values[labels]++
+	c.mu.Unlock()
+}
+
+// histogramVec est un ensemble d'histogrammes indexés par leurs
+// étiquettes, partageant les mêmes bornes.
+type histogramVec struct {
+	mu     *sync.Mutex
+	bounds []float64
+	values map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64 // par borne, non cumulés
+	count  uint64
+	sum    float64
+}
+
+func newHistogramVec(bounds []float64) histogramVec {
+	return histogramVec{mu: &sync.Mutex{}, bounds: bounds, values: make(map[string]*histogram)}
+}
+
+func (hv histogramVec) observe(labels string, v float64) {
+	hv.mu.Lock()
+	defer hv.mu.Unlock()
+
+	h, ok := hv.values[labels]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(hv.bounds))}
+		hv.values[labels] = h
+	}
+
+	if i, _ := slices.BinarySearch(hv.bounds, v); i < len(hv.bounds) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+// metricWriter écrit des métriques au format texte de Prometheus. La
+// première erreur d'écriture est conservée et les écritures suivantes
+// sont ignorées.
+type metricWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (mw *metricWriter) printf(format string, args ...any) {
+	if mw.err == nil {
+		_, mw.err = fmt.Fprintf(mw.w, format, args...)
+	}
+}
+
+func (mw *metricWriter) header(name, kind, help string) {
+	mw.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func (mw *metricWriter) sample(name, labels string, v float64) {
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	mw.printf("%s%s %s\n", name, labels, strconv.FormatFloat(v, 'g', -1, 64))
+}
+
+func (mw *metricWriter) counterVec(name, help string, c counterVec) {
+	mw.header(name, "counter", help)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, l := range sortedKeys(c.values) {
+		mw.sample(name, l, float64(c.values[l]))
+	}
+}
+
+func (mw *metricWriter) histogramVec(name, help string, hv histogramVec) {
+	mw.header(name, "histogram", help)
+
+	hv.mu.Lock()
+	defer hv.mu.Unlock()
+
+	for _, l := range sortedKeys(hv.values) {
+		h := hv.values[l]
+		prefix := l
+		if prefix != "" {
+			prefix += ","
+		}
+
+		var cumulative uint64
+		for i, bound := range hv.bounds {
+			cumulative += h.counts[i]
+			le := strconv.FormatFloat(bound, 'g', -1, 64)
+			mw.sample(name+"_bucket", prefix+labels("le", le), float64(cumulative))
+		}
+		mw.sample(name+"_bucket", prefix+labels("le", "+Inf"), float64(h.count))
+		mw.sample(name+"_sum", l, h.sum)
+		mw.sample(name+"_count", l, float64(h.count))
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// Retourne conn en comptant les octets échangés.
+func (h *Host) meterConn(conn net.Conn) net.Conn {
+	return meteredConn{Conn: conn, metrics: h.metrics}
+}
+
+// Retourne conn en comptant les octets échangés.
+func (h *Host) meterPacketConn(conn net.PacketConn) net.PacketConn {
+	return meteredPacketConn{PacketConn: conn, metrics: h.metrics}
+}
+
+// meteredConn compte les octets échangés sur une connexion.
+type meteredConn struct {
+	net.Conn
+	metrics *metrics
+}
+
+func (c meteredConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.metrics.bytesIn.Add(uint64(n))
+	return n, err
+}
+
+func (c meteredConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.metrics.bytesOut.Add(uint64(n))
+	return n, err
+}
+
+// meteredPacketConn compte les octets échangés par datagramme.
+type meteredPacketConn struct {
+	net.PacketConn
+	metrics *metrics
+}
+
+func (c meteredPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, addr, err := c.PacketConn.ReadFrom(b)
+	c.metrics.bytesIn.Add(uint64(n))
+	return n, addr, err
+}
+
+func (c meteredPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	n, err := c.PacketConn.WriteTo(b, addr)
+	c.metrics.bytesOut.Add(uint64(n))
+	return n, err
+}
@@ -0,0 +1,62 @@
+package core
+
+import "log/slog"
+
+// Une Option modifie la configuration d'un Host lors de sa création.
+type Option func(*Host)
+
+// Utilise le Transport donné à la place de TCPTransport.
+func WithTransport(transport Transport) Option {
+	return func(h *Host) {
+		h.transport = transport
+	}
+}
+
+// Annonce advertisedAddr aux autres noeuds plutôt que l'adresse
+// d'écoute, par exemple derrière une traduction d'adresse.
+func WithAdvertisedAddr(advertisedAddr string) Option {
+	return func(h *Host) {
+		h.advertisedAddr = advertisedAddr
+	}
+}
+
+// Demande au noeud d'amorçage l'adresse depuis laquelle il voit le
+// noeud local et l'annonce avec le port d'écoute, voir Host.Bootstrap.
+func WithAddrDiscovery() Option {
+	return func(h *Host) {
+		h.discoverAddr = true
+	}
+}
+
+// Utilise config à la place de DefaultConfig. La configuration est
+// vérifiée à la création du noeud, Host.Start retourne l'erreur si elle
+// est invalide.
+func WithConfig(config Config) Option {
+	return func(h *Host) {
+		h.config = config
+	}
+}
+
+// Rejoint le réseau identifié par networkId plutôt que DefaultNetworkId.
+func WithNetworkId(networkId string) Option {
+	return func(h *Host) {
+		h.networkId = networkId
+	}
+}
+
+// Journalise les événements du noeud avec logger. Par défaut, le noeud
+// ne journalise rien.
+func WithLogger(logger *slog.Logger) Option {
+	return func(h *Host) {
+		h.logger = logger
+	}
+}
+
+// Journalise le composant à partir de level plutôt que du niveau du
+// journal du noeud, voir LogComponents. Le Handler du journal doit
+// accepter ce niveau.
+func WithLogLevel(component string, level slog.Leveler) Option {
+	return func(h *Host) {
+		h.logLevels[component] = level
+	}
+}
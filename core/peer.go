@@ -2,12 +2,18 @@ package core
 
 import (
 	"sort"
+	"time"
 )
 
 // Peer est un noeud distant.
 type Peer struct {
 	Id   Id
 	Addr string // adresse physique du noeud
+
+	// Métadonnées locales maintenues par la table de routage, elles ne
+	// sont pas transmises aux autres noeuds.
+	lastSeen time.Time // dernier contact avec le noeud
+	failures int       // nombre d'échecs consécutifs de requête
 }
 
 // Trie les noeuds par distance croissante d’un identifiant.
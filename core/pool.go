@@ -0,0 +1,154 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// connPool conserve des connexions persistantes vers les noeuds
+// distants, au plus une par adresse. connPool est sûr pour une
+// utilisation concurrente.
+type connPool struct {
+	conns     map[string]*peerConn
+	transport Transport
+	handshake func(net.Conn) (net.Conn, session, error) // poignée de main des nouvelles connexions
+	mu        sync.Mutex
+
+	ttl      time.Duration // délai maximal d'attente d'une réponse
+	idleTtl  time.Duration // durée d'inactivité avant la fermeture d'une connexion
+	capacity int           // nombre maximal de connexions persistantes
+}
+
+func newConnPool(transport Transport, handshake func(net.Conn) (net.Conn, session, error), config Config) *connPool {
+	return &connPool{
+		conns:     make(map[string]*peerConn),
+		transport: transport,
+		handshake: handshake,
+		ttl:       config.ConnTtl,
+		idleTtl:   config.PoolIdleTtl,
+		capacity:  config.PoolCapacity,
+	}
+}
+
+// Envoie une requête au noeud[addr] et retourne sa réponse. La deuxième
+// valeur de retour indique si la réponse a été reçue sur une connexion
+// chiffrée, et donc authentifiée. Si la connexion persistante a été
+// fermée par le noeud distant, la requête est renvoyée une fois sur une
+// nouvelle connexion. Une requête dont le type n'est pas pris en charge
+// par le noeud distant n'est pas envoyée.
+func (p *connPool) request(ctx context.Context, addr string, req Request) (Response, bool, error) {
+	for attempt := 0; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return Response{}, false, err
+		}
+
+		c, pooled, err := p.get(addr)
+		if err != nil {
+			return Response{}, false, err
+		}
+
+		res, err := c.send(ctx, req)
+		if !pooled {
+			c.close()
+		}
+
+		if errors.Is(err, errConnClosed) && attempt == 0 {
+			continue
+		}
+
+		return res, c.session.secure, err
+	}
+}
+
+// Retourne une connexion vers le noeud[addr]. La deuxième valeur de
+// retour est false si le pool est plein et que la connexion ne doit
+// servir qu'une fois.
+func (p *connPool) get(addr string) (*peerConn, bool, error) {
+	p.mu.Lock()
+	if c, ok := p.conns[addr]; ok && !c.isClosed() {
+		p.mu.Unlock()
+		return c, true, nil
+	}
+	p.mu.Unlock()
+
+	conn, err := p.transport.Dial(addr, p.ttl)
+	if err != nil {
+		return nil, false, err
+	}
+
+	established, session, err := p.handshake(conn)
+	if err != nil {
+		conn.Close()
+		return nil, false, err
+	}
+	c := newPeerConn(established, session, p.ttl)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Une autre requête a pu ouvrir une connexion entre temps.
+	if existing, ok := p.conns[addr]; ok && !existing.isClosed() {
+		c.close()
+		return existing, true, nil
+	}
+
+	delete(p.conns, addr)
+	if len(p.conns) >= p.capacity && !p.evictIdle() {
+		return c, false, nil
+	}
+
+	p.conns[addr] = c
+	return c, true, nil
+}
+
+// Ferme la connexion inactive depuis le plus longtemps. Retourne
+// false si toutes les connexions ont des requêtes en cours.
+func (p *connPool) evictIdle() bool {
+	var oldestAddr string
+	var oldest time.Time
+
+	for addr, c := range p.conns {
+		if since, idle := c.idleSince(); idle && (oldestAddr == "" || since.Before(oldest)) {
+			oldestAddr = addr
+			oldest = since
+		}
+	}
+
+	if oldestAddr == "" {
+		return false
+	}
+
+	p.conns[oldestAddr].close()
+	delete(p.conns, oldestAddr)
+	return true
+}
+
+// Ferme les connexions inactives depuis plus de idleTtl.
+func (p *connPool) closeIdle() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	threshold := time.Now().Add(-p.idleTtl)
+
+	for addr, c := range p.conns {
+		since, idle := c.idleSince()
+		if c.isClosed() || (idle && since.Before(threshold)) {
+			c.close()
+			delete(p.conns, addr)
+		}
+	}
+}
+
+// Ferme toutes les connexions.
+func (p *connPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for addr, c := range p.conns {
+		c.close()
+		delete(p.conns, addr)
+	}
+}
@@ -0,0 +1,198 @@
+package core
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Répond aux count premières requêtes reçues sur chaque connexion dans
+// l'ordre inverse de leur arrivée, par l'identifiant de leur émetteur.
+// Retourne le nombre de connexions acceptées.
+func serveReversed(t *testing.T, listener net.Listener, count int) *atomic.Int32 {
+	var accepted atomic.Int32
+	codec := codecFor(ProtocolVersion)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+
+			go func() {
+				defer conn.Close()
+
+				type received struct {
+					reqId uint64
+					req   Request
+				}
+				var reqs []received
+
+				for len(reqs) < count {
+					reqId, payload, err := readFrame(conn)
+					if err != nil {
+						return
+					}
+
+					req, err := codec.decodeRequest(payload)
+					if err != nil {
+						t.Errorf("Requête invalide: %v", err)
+						return
+					}
+					reqs = append(reqs, received{reqId, req})
+				}
+
+				for i := len(reqs) - 1; i >= 0; i-- {
+					res, _ := codec.encodeResponse(Response{Type: PingRequestType, Id: reqs[i].req.SenderId})
+					writeFrame(conn, reqs[i].reqId, res)
+				}
+
+				// Attend la fermeture de la connexion par le pool.
+				readFrame(conn)
+			}()
+		}
+	}()
+
+	return &accepted
+}
+
+func TestPoolMultiplexing(t *testing.T) {
+	const count = 5
+
+	transport := NewMemoryTransport()
+	listener, err := transport.Listen("node-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	accepted := serveReversed(t, listener, count)
+
+	handshake := func(conn net.Conn) (net.Conn, session, error) {
+		return conn, session{version: ProtocolVersion, caps: localCapabilities}, nil
+	}
+	pool := newConnPool(transport, handshake, DefaultConfig())
+	defer pool.close()
+
+	// Ouvre la connexion persistante avant les requêtes simultanées.
+	if _, _, err := pool.get("node-b"); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := range count {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			req := newPingRequest()
+			req.SenderId = Id{byte(i)}
+
+			res, _, err := pool.request(context.Background(), "node-b", req)
+			if err != nil {
+				t.Errorf("Erreur lors de la requête %d: %v", i, err)
+				return
+			}
+
+			if !res.Id.Equal(req.SenderId) {
+				t.Errorf("La requête %d a reçu la réponse d'une autre requête", i)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := accepted.Load(); n != 1 {
+		t.Fatalf("%d connexions ouvertes, les requêtes auraient dû partager une connexion", n)
+	}
+}
+
+func TestPoolCapacity(t *testing.T) {
+	transport := NewMemoryTransport()
+
+	for _, addr := range []string{"node-b", "node-c", "node-d"} {
+		listener, err := transport.Listen(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer listener.Close()
+		serveReversed(t, listener, 1)
+	}
+
+	config := DefaultConfig()
+	config.PoolCapacity = 2
+
+	handshake := func(conn net.Conn) (net.Conn, session, error) {
+		return conn, session{version: ProtocolVersion, caps: localCapabilities}, nil
+	}
+	pool := newConnPool(transport, handshake, config)
+	defer pool.close()
+
+	for _, addr := range []string{"node-b", "node-c", "node-d"} {
+		if _, _, err := pool.request(context.Background(), addr, newPingRequest()); err != nil {
+			t.Fatalf("Erreur lors de la requête vers %s: %v", addr, err)
+		}
+	}
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	if len(pool.conns) != config.PoolCapacity {
+		t.Fatalf("%d connexions persistantes, au plus %d attendues", len(pool.conns), config.PoolCapacity)
+	}
+	if _, ok := pool.conns["node-b"]; ok {
+		t.Fatal("La connexion inactive depuis le plus longtemps aurait dû être fermée")
+	}
+}
+
+func TestDuplicateResponses(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	c := newPeerConn(client, session{version: ProtocolVersion, caps: localCapabilities}, time.Second)
+
+	// Une requête en attente dont la réponse n'est pas encore lue.
+	const reqId = 1 << 32
+	c.mu.Lock()
+	c.pending[reqId] = make(chan []byte, 1)
+	c.mu.Unlock()
+
+	// Le noeud distant répond deux fois à cette requête, puis répond
+	// normalement aux suivantes.
+	go func() {
+		writeFrame(server, reqId, []byte{1})
+		writeFrame(server, reqId, []byte{2})
+
+		for {
+			reqId, payload, err := readFrame(server)
+			if err != nil {
+				return
+			}
+			writeFrame(server, reqId, payload)
+		}
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.request(context.Background(), []byte{3})
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("La requête suivante aurait dû recevoir sa réponse: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("La réponse en double a bloqué la connexion")
+	}
+
+	if _, idle := c.idleSince(); !idle {
+		t.Fatal("La requête ayant reçu sa réponse aurait dû être retirée des requêtes en attente")
+	}
+}
@@ -0,0 +1,298 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"time"
+)
+
+const (
+	ProtocolVersion    = 5 // version du protocole implémentée par le noeud local
+	minProtocolVersion = 1 // plus ancienne version compatible, voir Config.AllowInsecure
+
+	// Réseau rejoint par défaut. Les noeuds de réseaux différents
+	// refusent de communiquer.
+	DefaultNetworkId = "gdfs"
+
+	maxNetworkIdSize = 255
+	maxReasonSize    = 255
+)
+
+// Octets d'en-tête identifiant une connexion gdfs. Les noeuds antérieurs
+// à la version 1, qui n'envoient pas de hello, ne sont pas pris en
+// charge : une connexion entrante ne commençant pas par protocolMagic
+// est refusée avec ErrIncompatiblePeer.
+var protocolMagic = [4]byte{'G', 'D', 'F', 'S'}
+
+var (
+	ErrIncompatiblePeer   = errors.New("incompatible peer")
+	errUnsupportedRequest = errors.New("request type not supported by peer")
+)
+
+// Réponses à un message hello.
+const (
+	helloAccepted = iota
+	helloRejected
+)
+
+// capabilities est l'ensemble des types de requête pris en charge par
+// un noeud. Le bit i est à 1 si le type de requête i est pris en charge.
+type capabilities uint64
+
+func capabilitiesOf(reqTypes ...int) capabilities {
+	var c capabilities
+	for _, reqType := range reqTypes {
+		c |= 1 << reqType
+	}
+	return c
+}
+
+func (c capabilities) has(reqType int) bool {
+	return reqType >= 0 && reqType < 64 && c&(1<<reqType) != 0
+}
+
+// Types de requête pris en charge par le noeud local.
+var localCapabilities = capabilitiesOf(
+	PingRequestType,
+	FindNodeRequestType,
+	FindValueRequestType,
+	StoreRequestType,
+	ObservedAddrRequestType,
+	LeaveRequestType,
+)
+
+// hello est le message échangé par les deux noeuds à l'ouverture d'une
+// connexion.
+type hello struct {
+	version   uint16
+	networkId string
+	caps      capabilities
+}
+
+// session décrit ce que deux noeuds ont convenu lors de la poignée de main.
+type session struct {
+	version uint16       // plus grande version commune
+	caps    capabilities // types de requête pris en charge par les deux noeuds
+
+	// La connexion est chiffrée à partir de secureVersion, remoteId est
+	// alors l'identifiant authentifié du noeud distant.
+	secure   bool
+	remoteId Id
+}
+
+func (h *Host) localHello() hello {
+	return hello{
+		version:   ProtocolVersion,
+		networkId: h.networkId,
+		caps:      localCapabilities,
+	}
+}
+
+// Vérifie que le noeud distant peut communiquer avec le noeud local.
+func (h *Host) checkHello(remote hello) error {
+	if remote.networkId != h.networkId {
+		return fmt.Errorf("network %q, expected %q", remote.networkId, h.networkId)
+	}
+
+	if minVersion := h.minVersion(); remote.version < minVersion {
+		return fmt.Errorf("protocol version %d, expected at least %d", remote.version, minVersion)
+	}
+
+	return nil
+}
+
+// Retourne la plus ancienne version du protocole acceptée par le noeud
+// local. Les hellos ne sont pas chiffrés, un intermédiaire pourrait
+// donc abaisser la version annoncée par les deux noeuds pour désactiver
+// le chiffrement sans être détecté. Les noeuds antérieurs à
+// secureVersion sont donc refusés, sauf avec AllowInsecure.
+func (h *Host) minVersion() uint16 {
+	if h.config.AllowInsecure {
+		return minProtocolVersion
+	}
+	return secureVersion
+}
+
+func (h *Host) sessionWith(remote hello) session {
+	return session{
+		version: min(remote.version, ProtocolVersion),
+		caps:    remote.caps & localCapabilities,
+	}
+}
+
+// Effectue la poignée de main à l'ouverture d'une connexion sortante et
+// retourne la connexion à utiliser, chiffrée si les deux noeuds le
+// permettent.
+func (h *Host) clientHandshake(conn net.Conn) (net.Conn, session, error) {
+	conn = h.meterConn(conn)
+	conn.SetDeadline(time.Now().Add(h.config.ConnTtl))
+	defer conn.SetDeadline(time.Time{})
+
+	local := h.localHello()
+	if err := writeHello(conn, local); err != nil {
+		return nil, session{}, err
+	}
+
+	var status [1]byte
+	if _, err := io.ReadFull(conn, status[:]); err != nil {
+		return nil, session{}, err
+	}
+
+	if status[0] == helloRejected {
+		reason, err := readShortString(conn)
+		if err != nil {
+			return nil, session{}, err
+		}
+		return nil, session{}, fmt.Errorf("%w: rejected by peer: %s", ErrIncompatiblePeer, reason)
+	}
+
+	remote, err := readHello(conn)
+	if err != nil {
+		return nil, session{}, err
+	}
+
+	if err := h.checkHello(remote); err != nil {
+		return nil, session{}, fmt.Errorf("%w: %v", ErrIncompatiblePeer, err)
+	}
+
+	s := h.sessionWith(remote)
+	if s.version < secureVersion {
+		return conn, s, nil
+	}
+
+	secure, remoteId, err := h.secureClient(conn, local, remote)
+	if err != nil {
+		return nil, session{}, err
+	}
+
+	s.secure = true
+	s.remoteId = remoteId
+	return secure, s, nil
+}
+
+// Effectue la poignée de main à l'ouverture d'une connexion entrante et
+// retourne la connexion à utiliser, chiffrée si les deux noeuds le
+// permettent. Un noeud incompatible reçoit la raison du refus.
+func (h *Host) serverHandshake(conn net.Conn) (net.Conn, session, error) {
+	conn = h.meterConn(conn)
+	conn.SetDeadline(time.Now().Add(h.config.ConnTtl))
+	defer conn.SetDeadline(time.Time{})
+
+	remote, err := readHello(conn)
+	if err != nil {
+		return nil, session{}, err
+	}
+
+	if err := h.checkHello(remote); err != nil {
+		if _, werr := conn.Write([]byte{helloRejected}); werr == nil {
+			writeShortString(conn, err.Error())
+		}
+		return nil, session{}, fmt.Errorf("%w: %v", ErrIncompatiblePeer, err)
+	}
+
+	if _, err := conn.Write([]byte{helloAccepted}); err != nil {
+		return nil, session{}, err
+	}
+
+	local := h.localHello()
+	if err := writeHello(conn, local); err != nil {
+		return nil, session{}, err
+	}
+
+	s := h.sessionWith(remote)
+	if s.version < secureVersion {
+		return conn, s, nil
+	}
+
+	secure, remoteId, err := h.secureServer(conn, local, remote)
+	if err != nil {
+		return nil, session{}, err
+	}
+
+	s.secure = true
+	s.remoteId = remoteId
+	return secure, s, nil
+}
+
+// Un hello est composé de protocolMagic, de la version (2 octets), des
+// types de requête pris en charge (8 octets) et de l'identifiant du
+// réseau précédé de sa taille (1 octet).
+func writeHello(w io.Writer, msg hello) error {
+	buf, err := encodeHello(msg)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(buf)
+	return err
+}
+
+func encodeHello(msg hello) ([]byte, error) {
+	if len(msg.networkId) > maxNetworkIdSize {
+		return nil, errors.New("network id too long")
+	}
+
+	buf := make([]byte, 0, 15+len(msg.networkId))
+	buf = append(buf, protocolMagic[:]...)
+	buf = binary.BigEndian.AppendUint16(buf, msg.version)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(msg.caps))
+	buf = append(buf, byte(len(msg.networkId)))
+	buf = append(buf, msg.networkId...)
+
+	return buf, nil
+}
+
+func readHello(r io.Reader) (hello, error) {
+	var header [14]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return hello{}, err
+	}
+
+	if [4]byte(header[0:4]) != protocolMagic {
+		return hello{}, fmt.Errorf("%w: not a gdfs peer", ErrIncompatiblePeer)
+	}
+
+	networkId, err := readShortString(r)
+	if err != nil {
+		return hello{}, err
+	}
+
+	return hello{
+		version:   binary.BigEndian.Uint16(header[4:6]),
+		caps:      capabilities(binary.BigEndian.Uint64(header[6:14])),
+		networkId: networkId,
+	}, nil
+}
+
+// Écrit une chaîne d'au plus 255 octets précédée de sa taille.
+func writeShortString(w io.Writer, s string) error {
+	if len(s) > maxReasonSize {
+		s = s[:maxReasonSize]
+	}
+
+	_, err := w.Write(append([]byte{byte(len(s))}, s...))
+	return err
+}
+
+func readShortString(r io.Reader) (string, error) {
+	var size [1]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return "", err
+	}
+
+	s := make([]byte, size[0])
+	if _, err := io.ReadFull(r, s); err != nil {
+		return "", err
+	}
+
+	return string(s), nil
+}
+
+// Retourne l'étiquette identifiant le réseau dans les datagrammes.
+func networkTag(networkId string) uint32 {
+	return crc32.ChecksumIEEE([]byte(networkId))
+}
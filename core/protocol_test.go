@@ -0,0 +1,212 @@
+package core
+
+import (
+	"encoding/gob"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// Relaie les octets de src vers dst en remplaçant l'octet à la
+// position i du flux par patch[i].
+func relay(dst, src net.Conn, patch map[int]byte) {
+	buf := make([]byte, 1024)
+	pos := 0
+
+	for {
+		n, err := src.Read(buf)
+		if err != nil {
+			dst.Close()
+			return
+		}
+
+		for i := range n {
+			if b, ok := patch[pos+i]; ok {
+				buf[i] = b
+			}
+		}
+		pos += n
+
+		if _, err := dst.Write(buf[:n]); err != nil {
+			src.Close()
+			return
+		}
+	}
+}
+
+// Effectue une poignée de main entre client et server à travers un
+// intermédiaire qui modifie les octets envoyés par chacun. Retourne les
+// erreurs des deux noeuds.
+func handshakeThrough(client, server *Host, fromClient, fromServer map[int]byte) (error, error) {
+	clientConn, clientRelay := net.Pipe()
+	serverRelay, serverConn := net.Pipe()
+
+	go relay(serverRelay, clientRelay, fromClient)
+	go relay(clientRelay, serverRelay, fromServer)
+
+	serverErr := make(chan error, 1)
+	go func() {
+		_, _, err := server.serverHandshake(serverConn)
+		serverErr <- err
+	}()
+
+	_, _, clientErr := client.clientHandshake(clientConn)
+	if clientErr != nil {
+		clientConn.Close()
+	}
+
+	err := <-serverErr
+	clientConn.Close()
+	serverConn.Close()
+
+	return clientErr, err
+}
+
+// Position de la version dans un hello envoyé par le client, et dans
+// la réponse du serveur, précédée de son statut.
+const (
+	clientVersionPos = len(protocolMagic)
+	serverVersionPos = 1 + len(protocolMagic)
+)
+
+func TestHandshake(t *testing.T) {
+	client := NewHost("node-a", NewMemoryStorage())
+	server := NewHost("node-b", NewMemoryStorage())
+
+	clientErr, serverErr := handshakeThrough(client, server, nil, nil)
+	if clientErr != nil || serverErr != nil {
+		t.Fatalf("La poignée de main aurait dû réussir: %v, %v", clientErr, serverErr)
+	}
+}
+
+func TestDowngradedHandshake(t *testing.T) {
+	client := NewHost("node-a", NewMemoryStorage())
+	server := NewHost("node-b", NewMemoryStorage())
+
+	// L'intermédiaire annonce aux deux noeuds la version 3, antérieure
+	// au chiffrement.
+	downgrade := func(pos int) map[int]byte {
+		return map[int]byte{pos: 0, pos + 1: secureVersion - 1}
+	}
+
+	clientErr, serverErr := handshakeThrough(client, server, downgrade(clientVersionPos), downgrade(serverVersionPos))
+	if !errors.Is(serverErr, ErrIncompatiblePeer) {
+		t.Fatalf("Le serveur aurait dû refuser la version abaissée: %v", serverErr)
+	}
+	if clientErr == nil {
+		t.Fatal("Le client aurait dû échouer après le refus du serveur")
+	}
+
+	clientErr, _ = handshakeThrough(client, server, nil, downgrade(serverVersionPos))
+	if !errors.Is(clientErr, ErrIncompatiblePeer) {
+		t.Fatalf("Le client aurait dû refuser la version abaissée: %v", clientErr)
+	}
+}
+
+func TestTamperedHandshake(t *testing.T) {
+	client := NewHost("node-a", NewMemoryStorage())
+	server := NewHost("node-b", NewMemoryStorage())
+
+	// L'intermédiaire abaisse la version annoncée par le client à une
+	// version chiffrée plus ancienne. Les hellos font partie de
+	// l'empreinte signée, la modification est détectée.
+	tampered := map[int]byte{clientVersionPos: 0, clientVersionPos + 1: secureVersion}
+
+	clientErr, serverErr := handshakeThrough(client, server, tampered, nil)
+	if !errors.Is(clientErr, errChannelAuth) {
+		t.Fatalf("Le client aurait dû détecter la modification du hello: %v", clientErr)
+	}
+	if serverErr == nil {
+		t.Fatal("Le serveur aurait dû échouer après le refus du client")
+	}
+}
+
+// baselineRequest est une requête d'un noeud antérieur au hello, encodée
+// avec gob sur une connexion brute.
+type baselineRequest struct {
+	Type       int
+	Id         Id
+	Value      Value
+	SenderAddr string
+	SenderId   Id
+}
+
+func TestBaselinePeer(t *testing.T) {
+	h := NewHost("node-a", NewMemoryStorage())
+
+	// Le noeud antérieur envoie directement sa requête.
+	client, server := net.Pipe()
+	go gob.NewEncoder(client).Encode(baselineRequest{Type: PingRequestType, SenderAddr: "node-old"})
+
+	_, _, err := h.serverHandshake(server)
+	client.Close()
+	server.Close()
+
+	if !errors.Is(err, ErrIncompatiblePeer) {
+		t.Fatalf("La requête d'un noeud antérieur au hello aurait dû être refusée: %v", err)
+	}
+
+	// Le noeud antérieur ne comprend pas le hello et ferme la connexion.
+	client, server = net.Pipe()
+	go func() {
+		defer server.Close()
+		server.SetDeadline(time.Now().Add(100 * time.Millisecond))
+
+		var req baselineRequest
+		if gob.NewDecoder(server).Decode(&req) == nil {
+			gob.NewEncoder(server).Encode(h.id)
+		}
+	}()
+
+	_, _, err = h.clientHandshake(client)
+	client.Close()
+
+	if err == nil {
+		t.Fatal("La poignée de main avec un noeud antérieur au hello aurait dû échouer")
+	}
+}
+
+func TestCodecNegotiation(t *testing.T) {
+	config := DefaultConfig()
+	config.AllowInsecure = true
+	h := NewHost("node-a", NewMemoryStorage(), WithConfig(config))
+
+	// Un noeud de la version 1 l'annonce dans son hello, les messages
+	// sont alors encodés avec gob.
+	client, server := net.Pipe()
+	go func() {
+		writeHello(client, hello{version: 1, networkId: h.networkId, caps: localCapabilities})
+		io.Copy(io.Discard, client)
+	}()
+
+	_, s, err := h.serverHandshake(server)
+	client.Close()
+	server.Close()
+
+	if err != nil || s.version != 1 {
+		t.Fatalf("La poignée de main aurait dû convenir de la version 1: %d, %v", s.version, err)
+	}
+	if _, ok := codecFor(s.version).(gobCodec); !ok {
+		t.Fatal("Les messages de la version 1 auraient dû être encodés avec gob")
+	}
+
+	// Un noeud qui n'envoie pas de hello est refusé avant le choix du
+	// codec, même si sa requête est au format binaire.
+	payload, err := codecFor(ProtocolVersion).encodeRequest(h.sign(newPingRequest()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, server = net.Pipe()
+	go writeFrame(client, 1, payload)
+
+	_, _, err = h.serverHandshake(server)
+	client.Close()
+	server.Close()
+
+	if !errors.Is(err, ErrIncompatiblePeer) {
+		t.Fatalf("Un noeud n'envoyant pas de hello aurait dû être refusé: %v", err)
+	}
+}
@@ -1,11 +1,20 @@
 package core
 
 import (
+	"crypto/rand"
 	"slices"
 	"sync"
+	"time"
 )
 
-type bucket []Peer
+// bucket contient des noeuds triés du moins récemment vu au plus
+// récemment vu, ainsi qu'un cache de remplaçants qui prennent la place
+// des noeuds retirés.
+type bucket struct {
+	peers        []Peer
+	replacements []Peer    // triés du moins récemment vu au plus récemment vu
+	lastLookup   time.Time // dernière recherche d'un identifiant du bucket
+}
 
 // routingTable est la table de routage du noeud local. Elle contient
 // ses noeuds connus. Elle fonctionne de manière à connaître mieux
@@ -16,50 +25,202 @@ type routingTable struct {
 	id      Id // l'identifiant du noeud local
 	mu      sync.Mutex
 	cancel  chan struct{}
+
+	capacity         int // nombre maximum de noeuds par bucket
+	replacementsSize int // nombre maximum de remplaçants par bucket
 }
 
-func newRoutingTable(id Id) *routingTable {
+func newRoutingTable(id Id, capacity, replacementsSize int) *routingTable {
 	rt := routingTable{
-		id:     id,
-		cancel: make(chan struct{}),
+		id:               id,
+		cancel:           make(chan struct{}),
+		capacity:         capacity,
+		replacementsSize: replacementsSize,
 	}
 
 	for i := range rt.buckets {
-		rt.buckets[i] = make(bucket, 0, bucketCapacity)
+		rt.buckets[i].peers = make([]Peer, 0, capacity)
 	}
 
 	return &rt
 }
 
+// Ajoute un noeud à la table de routage et retourne true s'il n'y était
+// pas déjà. Un noeud déjà présent est marqué comme le plus récemment vu
+// de son bucket. Si le bucket est plein, le noeud est placé dans le
+// cache de remplaçants.
 func (rt *routingTable) addPeer(peer Peer) bool {
 	bucket := rt.getBucketOf(peer.Id)
 
 	rt.mu.Lock()
 	defer rt.mu.Unlock()
 
-	if len(*bucket) >= bucketCapacity {
+	peer.lastSeen = time.Now()
+	peer.failures = 0
+
+	if i := indexOfPeer(bucket.peers, peer.Id); i >= 0 {
+		bucket.peers = slices.Delete(bucket.peers, i, i+1)
+		bucket.peers = append(bucket.peers, peer)
 		return false
 	}
 
-	for _, existing := range *bucket {
-		if existing.Id.Equal(peer.Id) {
-			return false
+	if i := indexOfPeer(bucket.replacements, peer.Id); i >= 0 {
+		bucket.replacements = slices.Delete(bucket.replacements, i, i+1)
+	}
+
+	if len(bucket.peers) >= rt.capacity {
+		bucket.replacements = append(bucket.replacements, peer)
+		if len(bucket.replacements) > rt.replacementsSize {
+			bucket.replacements = bucket.replacements[1:]
 		}
+		return false
 	}
 
-	*bucket = append(*bucket, peer)
+	bucket.peers = append(bucket.peers, peer)
 	return true
 }
 
-func (rt *routingTable) removePeer(id Id) bool {
+// Retire un noeud de la table de routage et de son cache de remplaçants.
+// Le noeud retiré de la table de routage est retourné.
+func (rt *routingTable) removePeer(id Id) (Peer, bool) {
+	bucket := rt.getBucketOf(id)
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	if i := indexOfPeer(bucket.replacements, id); i >= 0 {
+		bucket.replacements = slices.Delete(bucket.replacements, i, i+1)
+	}
+
+	if i := indexOfPeer(bucket.peers, id); i >= 0 {
+		peer := bucket.peers[i]
+		bucket.peers = slices.Delete(bucket.peers, i, i+1)
+		return peer, true
+	}
+
+	return Peer{}, false
+}
+
+// Déplace le remplaçant le plus récemment vu dans le bucket de id si ce
+// dernier n'est pas plein. Le noeud promu est retourné.
+func (rt *routingTable) promoteReplacement(id Id) (Peer, bool) {
+	bucket := rt.getBucketOf(id)
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	n := len(bucket.replacements)
+	if n == 0 || len(bucket.peers) >= rt.capacity {
+		return Peer{}, false
+	}
+
+	peer := bucket.replacements[n-1]
+	bucket.replacements = bucket.replacements[:n-1]
+	bucket.peers = append(bucket.peers, peer)
+
+	return peer, true
+}
+
+// Retourne le noeud le moins récemment vu du bucket de id si celui-ci
+// est plein et ne contient pas id.
+func (rt *routingTable) evictionCandidate(id Id) (Peer, bool) {
+	bucket := rt.getBucketOf(id)
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	if len(bucket.peers) < rt.capacity || indexOfPeer(bucket.peers, id) >= 0 {
+		return Peer{}, false
+	}
+
+	return bucket.peers[0], true
+}
+
+// Incrémente le nombre d'échecs consécutifs d'un noeud et le retourne.
+func (rt *routingTable) failPeer(id Id) int {
+	bucket := rt.getBucketOf(id)
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	if i := indexOfPeer(bucket.peers, id); i >= 0 {
+		bucket.peers[i].failures++
+		return bucket.peers[i].failures
+	}
+
+	return 0
+}
+
+// Marque le bucket de id comme récemment parcouru par une recherche.
+func (rt *routingTable) touchBucket(id Id) {
+	if id.Equal(rt.id) {
+		return
+	}
+
 	bucket := rt.getBucketOf(id)
 
 	rt.mu.Lock()
 	defer rt.mu.Unlock()
 
-	for i, peer := range *bucket {
-		if peer.Id.Equal(id) {
-			*bucket = slices.Delete(*bucket, i, i+1)
+	bucket.lastLookup = time.Now()
+}
+
+// Retourne les index des buckets sans recherche depuis since. Les
+// buckets plus proches que le plus proche noeud connu sont ignorés
+// car aucun noeud n'y est attendu.
+func (rt *routingTable) staleBuckets(since time.Time) []int {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	stale := make([]int, 0)
+	closestFound := false
+
+	for i, bucket := range rt.buckets {
+		if len(bucket.peers) > 0 {
+			closestFound = true
+		}
+
+		if closestFound && bucket.lastLookup.Before(since) {
+			stale = append(stale, i)
+		}
+	}
+
+	return stale
+}
+
+// Retourne un identifiant aléatoire appartenant au bucket d'index i.
+func (rt *routingTable) randomIdIn(i int) Id {
+	prefixLen := IdSize*8 - i - 1
+
+	var id Id
+	_, _ = rand.Read(id[:])
+
+	// Les prefixLen premiers bits sont ceux du noeud local, le suivant
+	// est inversé.
+	for bit := 0; bit <= prefixLen; bit++ {
+		mask := byte(1 << (7 - bit%8))
+		ownBit := rt.id[bit/8] & mask
+
+		if bit == prefixLen {
+			ownBit ^= mask
+		}
+
+		id[bit/8] = id[bit/8]&^mask | ownBit
+	}
+
+	return id
+}
+
+// Indique si le noeud est connu à la même adresse, dans son bucket ou
+// dans le cache de remplaçants.
+func (rt *routingTable) contains(peer Peer) bool {
+	bucket := rt.getBucketOf(peer.Id)
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	for _, peers := range [][]Peer{bucket.peers, bucket.replacements} {
+		if i := indexOfPeer(peers, peer.Id); i >= 0 && peers[i].Addr == peer.Addr {
 			return true
 		}
 	}
@@ -74,14 +235,24 @@ func (rt *routingTable) peers() []Peer {
 	defer rt.mu.Unlock()
 
 	for _, bucket := range rt.buckets {
-		peers = append(peers, bucket[:]...)
+		peers = append(peers, bucket.peers...)
 	}
 
 	return peers
 }
 
 func (rt *routingTable) getBucketOf(id Id) *bucket {
+	return &rt.buckets[rt.bucketIndex(id)]
+}
+
+// Retourne l'index du bucket de id.
+func (rt *routingTable) bucketIndex(id Id) int {
 	prefixLen := rt.id.PrefixLen(id)
-	index := IdSize*8 - prefixLen - 1
-	return &rt.buckets[index]
+	return IdSize*8 - prefixLen - 1
+}
+
+func indexOfPeer(peers []Peer, id Id) int {
+	return slices.IndexFunc(peers, func(peer Peer) bool {
+		return peer.Id.Equal(id)
+	})
 }
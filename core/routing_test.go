@@ -0,0 +1,150 @@
+package core
+
+import (
+	"io"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Retourne un noeud du bucket le plus éloigné d'une table de routage
+// dont l'identifiant est nul.
+func farPeer(i int) Peer {
+	return Peer{Id: Id{0x80, byte(i)}, Addr: string(rune('a' + i))}
+}
+
+func TestLeastRecentlySeenEviction(t *testing.T) {
+	rt := newRoutingTable(Id{}, 2, 2)
+
+	for i := range 2 {
+		if !rt.addPeer(farPeer(i)) {
+			t.Fatalf("Le noeud %d aurait dû être ajouté", i)
+		}
+	}
+
+	// Le noeud 0 est vu à nouveau, le noeud 1 devient le moins
+	// récemment vu.
+	rt.addPeer(farPeer(0))
+
+	if rt.addPeer(farPeer(2)) {
+		t.Fatal("Le bucket plein n'aurait pas dû accepter un nouveau noeud")
+	}
+
+	lrs, ok := rt.evictionCandidate(farPeer(2).Id)
+	if !ok || !lrs.Id.Equal(farPeer(1).Id) {
+		t.Fatalf("Le noeud le moins récemment vu aurait dû être le noeud 1: %v", lrs.Id)
+	}
+
+	if _, ok := rt.removePeer(lrs.Id); !ok {
+		t.Fatal("Le noeud le moins récemment vu aurait dû être retiré")
+	}
+
+	promoted, ok := rt.promoteReplacement(lrs.Id)
+	if !ok || !promoted.Id.Equal(farPeer(2).Id) {
+		t.Fatal("Le remplaçant aurait dû prendre la place du noeud retiré")
+	}
+
+	if !rt.contains(farPeer(0)) || !rt.contains(farPeer(2)) || rt.contains(farPeer(1)) {
+		t.Fatal("Le bucket devrait contenir les noeuds 0 et 2")
+	}
+}
+
+func TestReplacementCache(t *testing.T) {
+	rt := newRoutingTable(Id{}, 1, 2)
+
+	for i := range 4 {
+		rt.addPeer(farPeer(i))
+	}
+
+	// Le cache ne conserve que les deux remplaçants les plus récents.
+	if rt.contains(farPeer(1)) {
+		t.Fatal("Le remplaçant le moins récemment vu aurait dû être oublié")
+	}
+
+	for _, want := range []int{3, 2} {
+		rt.removePeer(rt.peers()[0].Id)
+
+		promoted, ok := rt.promoteReplacement(farPeer(want).Id)
+		if !ok || !promoted.Id.Equal(farPeer(want).Id) {
+			t.Fatalf("Le remplaçant %d aurait dû être promu", want)
+		}
+	}
+
+	rt.removePeer(farPeer(2).Id)
+	if _, ok := rt.promoteReplacement(farPeer(2).Id); ok {
+		t.Fatal("Le cache de remplaçants aurait dû être vide")
+	}
+}
+
+func TestBucketRefresh(t *testing.T) {
+	rt := newRoutingTable(NewRandomId(), 20, 10)
+
+	for _, i := range []int{0, 42, IdSize*8 - 1} {
+		if index := rt.bucketIndex(rt.randomIdIn(i)); index != i {
+			t.Fatalf("L'identifiant aléatoire du bucket %d appartient au bucket %d", i, index)
+		}
+	}
+
+	peer := Peer{Id: rt.randomIdIn(42), Addr: "a"}
+	rt.addPeer(peer)
+
+	since := time.Now()
+	stale := rt.staleBuckets(since)
+	if len(stale) != IdSize*8-42 || stale[0] != 42 {
+		t.Fatalf("Seuls les buckets à partir du plus proche noeud connu devraient être rafraîchis: %v", stale)
+	}
+
+	rt.touchBucket(rt.randomIdIn(100))
+	if slices.Contains(rt.staleBuckets(since), 100) {
+		t.Fatal("Un bucket parcouru par une recherche n'aurait pas dû être rafraîchi")
+	}
+}
+
+func TestStoppedHostChecks(t *testing.T) {
+	transport := NewMemoryTransport()
+
+	// Un noeud qui accepte les connexions sans jamais répondre.
+	listener, err := transport.Listen("node-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(io.Discard, conn)
+		}
+	}()
+
+	config := DefaultConfig()
+	config.ConnTtl = time.Second
+
+	h := NewHost("node-a", NewMemoryStorage(), WithTransport(transport), WithConfig(config))
+	peer := Peer{Id: NewRandomId(), Addr: "node-b"}
+	h.rt.addPeer(peer)
+
+	// Un noeud qui n'est pas démarré ne lance aucune vérification.
+	h.checkPeer(peer)
+	h.admitPeer(Peer{Id: NewRandomId(), Addr: "node-c"}, memoryAddr("node-c"))
+	h.acceptsDatagrams(nil, peer.Addr)
+
+	if len(h.checking) != 0 || len(h.pending.peers) != 0 || len(h.datagramPeers) != 0 {
+		t.Fatal("Un noeud non démarré n'aurait dû lancer aucune vérification")
+	}
+
+	// Une vérification interrompue par l'arrêt du noeud local ne retire
+	// pas le noeud vérifié.
+	if err := h.Start(); err != nil {
+		t.Fatal(err)
+	}
+	h.checkPeer(peer)
+	h.Stop()
+
+	if !h.rt.contains(peer) {
+		t.Fatal("Un noeud dont la vérification a été interrompue n'aurait pas dû être retiré")
+	}
+}
@@ -0,0 +1,191 @@
+package core
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+)
+
+// Priorité d'une requête reçue. Les requêtes de priorité supérieure sont
+// traitées plus souvent, sans que les autres ne soient jamais affamées.
+type requestPriority int
+
+const (
+	highPriority   requestPriority = iota // PING, FIND_NODE et adresse observée
+	normalPriority                        // FIND_VALUE
+	lowPriority                           // STORE
+
+	priorityCount = 3
+)
+
+func (p requestPriority) String() string {
+	switch p {
+	case highPriority:
+		return "high"
+	case normalPriority:
+		return "normal"
+	default:
+		return "low"
+	}
+}
+
+// Retourne la priorité d'un type de requête. Les requêtes maintenant
+// le réseau passent avant les recherches de valeurs, elles-mêmes avant
+// les stockages.
+func priorityOf(reqType int) requestPriority {
+	switch reqType {
+	case FindValueRequestType:
+		return normalPriority
+	case StoreRequestType:
+		return lowPriority
+	default:
+		return highPriority
+	}
+}
+
+// Ordre de service des priorités : sur sept requêtes traitées lorsque
+// toutes les files attendent, quatre sont de priorité haute, deux de
+// priorité normale et une de priorité basse.
+var priorityWeights = [...]requestPriority{
+	highPriority, normalPriority, highPriority, lowPriority,
+	highPriority, normalPriority, highPriority,
+}
+
+// inboundRequest est une requête admise en attente d'un worker. Sa
+// réponse est envoyée sur done.
+type inboundRequest struct {
+	req      Request
+	verified bool // la requête est signée par son émetteur
+	observed net.Addr
+	done     chan Response
+}
+
+// requestQueue est la file des requêtes reçues, avec une file bornée par
+// priorité.
+type requestQueue struct {
+	queues [priorityCount]chan *inboundRequest
+	turn   *atomic.Uint64 // tour courant dans priorityWeights
+}
+
+func newRequestQueue(size int) requestQueue {
+	q := requestQueue{turn: &atomic.Uint64{}}
+	for i := range q.queues {
+		q.queues[i] = make(chan *inboundRequest, size)
+	}
+	return q
+}
+
+// Ajoute une requête à la file de sa priorité sans attendre. Retourne
+// false si cette file est pleine.
+func (q requestQueue) push(r *inboundRequest) bool {
+	select {
+	case q.queues[priorityOf(r.req.Type)] <- r:
+		return true
+	default:
+		return false
+	}
+}
+
+// Retourne la prochaine requête, en attendant qu'une requête arrive. La
+// priorité servie suit priorityWeights ; si sa file est vide, la requête
+// de plus haute priorité en attente est retournée. Retourne false si
+// done est fermé.
+func (q requestQueue) pop(done <-chan struct{}) (*inboundRequest, bool) {
+	turn := (q.turn.Add(1) - 1) % uint64(len(priorityWeights))
+	select {
+	case r := <-q.queues[priorityWeights[turn]]:
+		return r, true
+	default:
+	}
+
+	for _, queue := range q.queues {
+		select {
+		case r := <-queue:
+			return r, true
+		default:
+		}
+	}
+
+	select {
+	case r := <-q.queues[highPriority]:
+		return r, true
+	case r := <-q.queues[normalPriority]:
+		return r, true
+	case r := <-q.queues[lowPriority]:
+		return r, true
+	case <-done:
+		return nil, false
+	}
+}
+
+// Retourne le nombre de requêtes en attente d'une priorité.
+func (q requestQueue) len(p requestPriority) int {
+	return len(q.queues[p])
+}
+
+// Retourne le nombre de requêtes reçues en attente d'un worker.
+func (h *Host) QueuedRequests() int {
+	n := 0
+	for p := range requestPriority(priorityCount) {
+		n += h.requests.len(p)
+	}
+	return n
+}
+
+// Démarre RequestWorkers workers traitant les requêtes reçues selon leur
+// priorité.
+func (h *Host) startWorkers() {
+	for range h.config.RequestWorkers {
+		h.wg.Add(1)
+		go func() {
+			defer h.wg.Done()
+
+			for {
+				r, ok := h.requests.pop(h.ctx.Done())
+				if !ok {
+					return
+				}
+
+				r.done <- h.handleReq(r.req, r.verified, r.observed)
+			}
+		}()
+	}
+}
+
+// Confie une requête reçue aux workers et attend sa réponse. La requête
+// passe le contrôle d'admission avant d'entrer dans la file, voir
+// admitReq : un émetteur dépassant son débit ne peut pas occuper la file
+// au détriment des autres. Une requête refusée par le contrôle
+// d'admission, ou dont la file est pleine, reçoit une réponse busy sans
+// être traitée.
+func (h *Host) schedule(req Request, observed net.Addr) (Response, error) {
+	verified, err := h.admitReq(req, observed)
+
+	var busy *BusyError
+	if errors.As(err, &busy) {
+		return busyResponse(req, busy.RetryAfter), nil
+	}
+	if err != nil {
+		return Response{}, err
+	}
+
+	r := &inboundRequest{
+		req:      req,
+		verified: verified,
+		observed: observed,
+		done:     make(chan Response, 1),
+	}
+
+	if !h.requests.push(r) {
+		h.log.rpc.Debug("request queue full", "remote", observed, requestTypeAttr(req.Type))
+		h.metrics.observeRejected("queue", requestTypeName(req.Type))
+		return busyResponse(req, queueRetryAfter), nil
+	}
+
+	select {
+	case res := <-r.done:
+		return res, nil
+	case <-h.ctx.Done():
+		return Response{}, h.ctx.Err()
+	}
+}
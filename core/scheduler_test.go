@@ -0,0 +1,30 @@
+package core
+
+import "testing"
+
+func TestLowPriorityProgress(t *testing.T) {
+	q := newRequestQueue(64)
+
+	for range 64 {
+		q.push(&inboundRequest{req: newPingRequest()})
+	}
+	q.push(&inboundRequest{req: newStoreRequest(Id{1}, Value{1})})
+
+	done := make(chan struct{})
+
+	// Les requêtes de priorité haute arrivent aussi vite qu'elles sont
+	// traitées.
+	for range len(priorityWeights) {
+		r, ok := q.pop(done)
+		if !ok {
+			t.Fatal("La file aurait dû retourner une requête")
+		}
+
+		if r.req.Type == StoreRequestType {
+			return
+		}
+		q.push(&inboundRequest{req: newPingRequest()})
+	}
+
+	t.Fatalf("Le STORE aurait dû être traité en moins de %d requêtes", len(priorityWeights))
+}
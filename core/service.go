@@ -4,135 +4,203 @@
 // automatiquement une table de routage.
 package core
 
-// Retrouve les bucketCapacity noeuds les plus proches de target.
-func (h *Host) FindNode(target Id) []Peer {
-	closestPeers := h.closestPeersFrom(target, bucketCapacity)
-	visitedPeers := make(peerSet)
-	discoveredPeers := make(peerSet)
+import (
+	"context"
+	"time"
+)
 
-	discoveredPeers.addMany(closestPeers)
+// Retrouve les BucketCapacity noeuds les plus proches de target.
+func (h *Host) FindNode(target Id) []Peer {
+	return h.FindNodeContext(context.Background(), target)
+}
 
-	for {
-		batch := nextBatch(closestPeers, visitedPeers)
-		if len(batch) == 0 {
-			break
-		}
-		visitedPeers.addMany(batch)
-
-		for _, peer := range batch {
-			if newPeers, err := h.findNodeFrom(peer.Addr, target); err == nil {
-				for _, newPeer := range newPeers {
-					if !discoveredPeers.has(newPeer) {
-						closestPeers = append(closestPeers, newPeer)
-						discoveredPeers.add(newPeer)
-
-						if !newPeer.Id.Equal(h.id) {
-							h.rt.addPeer(newPeer)
-						}
-					}
-				}
-			}
-		}
+// Comme FindNode, mais les requêtes en cours sont abandonnées à
+// l'annulation de ctx. Les noeuds ayant déjà répondu sont retournés.
+func (h *Host) FindNodeContext(ctx context.Context, target Id) []Peer {
+	peers, _ := h.findNode(ctx, target)
+	return peers
+}
 
-		sortPeersByDistance(closestPeers, target)
-		closestPeers = firstNPeers(closestPeers, bucketCapacity)
-	}
+// Comme FindNodeContext. La deuxième valeur de retour indique si au
+// moins une requête a dépassé son délai.
+func (h *Host) findNode(ctx context.Context, target Id) ([]Peer, bool) {
+	peers, _, _, timedOut := h.lookup(ctx, target, func(peer Peer) lookupResult {
+		peers, verified, err := h.findNodeFrom(ctx, peer, target)
+		return lookupResult{peers: peers, verified: verified, err: err}
+	})
 
-	return closestPeers
+	return peers, timedOut
 }
 
 // Retrouve la valeur associée à l'identifiant. La deuxième valeur
 // de retour est true si et seulement si la donnée a été retrouvée.
 func (h *Host) FindValue(id Id) (Value, bool) {
-	closestPeers := h.closestPeersFrom(id, bucketCapacity)
-	visitedPeers := make(peerSet)
-	discoveredPeers := make(peerSet)
+	return h.FindValueContext(context.Background(), id)
+}
 
-	discoveredPeers.addMany(closestPeers)
+// Comme FindValue, mais la recherche est abandonnée à l'annulation
+// de ctx.
+func (h *Host) FindValueContext(ctx context.Context, id Id) (Value, bool) {
+	value, err := h.Retrieve(ctx, id)
+	return value, err == nil
+}
 
-	for {
-		batch := nextBatch(closestPeers, visitedPeers)
-		if len(batch) == 0 {
-			break
-		}
-		visitedPeers.addMany(batch)
-
-		for _, peer := range batch {
-			if res, err := h.findValueFrom(peer.Addr, id); err == nil {
-				if res.Found {
-					return res.Value, true
-				}
-
-				for _, newPeer := range res.Nodes {
-					if !discoveredPeers.has(newPeer) {
-						closestPeers = append(closestPeers, newPeer)
-						discoveredPeers.add(newPeer)
-
-						if !newPeer.Id.Equal(h.id) {
-							h.rt.addPeer(newPeer)
-						}
-					}
-				}
-			}
+// Retrouve la valeur associée à l'identifiant. Une valeur ne
+// correspondant pas à son identifiant est ignorée. Retourne ErrNotFound
+// si aucun noeud interrogé ne détient la valeur, ErrNoPeers si aucun
+// noeud n'a répondu, ou l'erreur de ctx s'il est annulé. Si aucun noeud
+// n'a répondu car des requêtes ont dépassé leur délai, ou si ctx a
+// dépassé le sien, l'erreur satisfait errors.Is(err, ErrTimeout).
+func (h *Host) Retrieve(ctx context.Context, id Id) (Value, error) {
+	peers, value, found, timedOut := h.lookup(ctx, id, func(peer Peer) lookupResult {
+		res, verified, err := h.findValueFrom(ctx, peer, id)
+		if err == nil && res.Found && !NewIdFrom(res.Value[:]).Equal(id) {
+			err = errCorruptValue
 		}
 
-		sortPeersByDistance(closestPeers, id)
-		closestPeers = firstNPeers(closestPeers, bucketCapacity)
+		return lookupResult{
+			peers:    res.Peers,
+			value:    res.Value,
+			found:    res.Found,
+			verified: verified,
+			err:      err,
+		}
+	})
+
+	switch {
+	case found:
+		return value, nil
+	case ctx.Err() != nil:
+		return Value{}, contextError(ctx)
+	case len(peers) == 0:
+		return Value{}, noPeersError(timedOut)
+	default:
+		return Value{}, ErrNotFound
 	}
-
-	return Value{}, false
 }
 
 // Stocke la valeur et renvoie son identifiant. La deuxième valeur
 // de retour est le nombre de replicas qui ont été stockés. Si le
 // nombre de replicas est nul, alors la donnée n’a pas été
-// correctement stockée.
+// correctement stockée. Tant que le noeud local est actif, la valeur
+// est republiée périodiquement pendant PublishedTtl, ou jusqu'à l'appel
+// de Unpublish.
 func (h *Host) StoreValue(value Value) (Id, int) {
+	return h.StoreValueContext(context.Background(), value)
+}
+
+// Comme StoreValue, mais les requêtes en cours sont abandonnées à
+// l'annulation de ctx. Les replicas déjà stockés sont comptés.
+func (h *Host) StoreValueContext(ctx context.Context, value Value) (Id, int) {
+	id, replicas, _ := h.Publish(ctx, value)
+	return id, replicas
+}
+
+// Stocke la valeur comme StoreValue et retourne son identifiant et le
+// nombre de replicas stockés. Retourne une InsufficientReplicasError si
+// la valeur a été stockée sur moins de MinReplicasCount noeuds,
+// ErrNoPeers si aucun noeud n'a été trouvé ou n'a répondu, ou l'erreur
+// de ctx s'il est annulé. Comme pour Retrieve, l'erreur satisfait
+// errors.Is(err, ErrTimeout) si c'est faute de réponse dans les délais.
+func (h *Host) Publish(ctx context.Context, value Value) (Id, int, error) {
 	id := NewIdFrom(value[:])
 
-	peers := h.FindNode(id)
-	replicasCount := 0
+	h.addPublished(id, value)
 
-	for _, peer := range peers {
-		if ok, err := h.storeTo(peer.Addr, id, value); err == nil && ok {
-			replicasCount++
-			if replicasCount >= maxReplicasCount {
-				break
-			}
+	replicas, err := h.storeToClosest(ctx, id, value)
+	if err == nil && replicas < h.config.MinReplicasCount {
+		err = &InsufficientReplicasError{
+			Id:       id,
+			Replicas: replicas,
+			Required: h.config.MinReplicasCount,
 		}
 	}
 
-	return id, replicasCount
+	return id, replicas, err
 }
 
-type peerSet map[Peer]struct{}
+// publishedValue est une valeur publiée par le noeud local.
+type publishedValue struct {
+	value    Value
+	expireAt time.Time // fin de la republication
+}
 
-func (s peerSet) addMany(peers []Peer) {
-	for _, peer := range peers {
-		s.add(peer)
+// Ajoute une valeur aux valeurs republiées par le noeud local pendant
+// PublishedTtl. Publier à nouveau une valeur repousse son expiration.
+// Au-delà de MaxPublished valeurs, celle qui expire le plus tôt n'est
+// plus republiée.
+func (h *Host) addPublished(id Id, value Value) {
+	h.publishedMu.Lock()
+	defer h.publishedMu.Unlock()
+
+	if _, ok := h.published[id]; !ok && len(h.published) >= h.config.MaxPublished {
+		var oldest Id
+		var oldestExpiry time.Time
+
+		for id, p := range h.published {
+			if oldestExpiry.IsZero() || p.expireAt.Before(oldestExpiry) {
+				oldest, oldestExpiry = id, p.expireAt
+			}
+		}
+
+		delete(h.published, oldest)
 	}
-}
 
-func (s peerSet) add(peer Peer) {
-	s[peer] = struct{}{}
+	h.published[id] = publishedValue{
+		value:    value,
+		expireAt: time.Now().Add(h.config.PublishedTtl),
+	}
 }
 
-func (s peerSet) has(peer Peer) bool {
-	_, ok := s[peer]
-	return ok
+// Arrête la republication d'une valeur publiée par le noeud local.
+// La valeur disparaîtra du réseau à son expiration.
+func (h *Host) Unpublish(id Id) {
+	h.publishedMu.Lock()
+	defer h.publishedMu.Unlock()
+
+	delete(h.published, id)
 }
 
-func nextBatch(peers []Peer, visited peerSet) []Peer {
-	batch := make([]Peer, 0, batchSize)
+// Stocke la paire identifiant-valeur sur les noeuds les plus proches
+// de l'identifiant et retourne le nombre de replicas stockés. Retourne
+// ErrNoPeers si aucun noeud n'a été trouvé, ou si aucun n'a répondu car
+// les requêtes ont dépassé leur délai.
+func (h *Host) storeToClosest(ctx context.Context, id Id, value Value) (int, error) {
+	peers, timedOut := h.findNode(ctx, id)
+	if len(peers) == 0 {
+		if ctx.Err() != nil {
+			return 0, contextError(ctx)
+		}
+		return 0, noPeersError(timedOut)
+	}
+
+	replicasCount := 0
+	answered := false
 
 	for _, peer := range peers {
-		if !visited.has(peer) {
-			batch = append(batch, peer)
-			if len(batch) >= batchSize {
-				return batch
+		ok, err := h.storeTo(ctx, peer, id, value)
+		if ctx.Err() != nil {
+			return replicasCount, contextError(ctx)
+		}
+
+		if err != nil {
+			h.peerFailed(peer, err)
+			timedOut = timedOut || isTimeout(err)
+			continue
+		}
+		answered = true
+
+		if ok {
+			replicasCount++
+			if replicasCount >= h.config.MaxReplicasCount {
+				break
 			}
 		}
 	}
 
-	return batch
+	if !answered && timedOut {
+		return 0, noPeersError(true)
+	}
+
+	return replicasCount, nil
 }
@@ -0,0 +1,22 @@
+package core
+
+import "testing"
+
+func TestPublishedBound(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxPublished = 2
+
+	h := NewHost("node-a", NewMemoryStorage(), WithTransport(NewMemoryTransport()), WithConfig(config))
+
+	for i := range 3 {
+		h.addPublished(NewIdFrom([]byte{byte(i)}), Value{byte(i)})
+	}
+
+	if len(h.published) != config.MaxPublished {
+		t.Fatalf("%d valeurs republiées, %d attendues", len(h.published), config.MaxPublished)
+	}
+
+	if _, ok := h.published[NewIdFrom([]byte{0})]; ok {
+		t.Fatal("La valeur expirant le plus tôt aurait dû être oubliée")
+	}
+}
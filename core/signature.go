@@ -0,0 +1,116 @@
+package core
+
+import (
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// Version du protocole à partir de laquelle les messages sont signés.
+const signedVersion = 3
+
+var (
+	errInvalidSignature = errors.New("invalid request signature")
+	errUnverifiedPeer   = errors.New("peer did not prove its identity")
+	errUnexpectedPeer   = errors.New("response signed by an unexpected peer")
+)
+
+// Retourne l'identifiant d'un noeud à partir de sa clé publique.
+func IdFromPublicKey(pub ed25519.PublicKey) Id {
+	return NewIdFrom(pub)
+}
+
+// Signe une requête avec la clé du noeud local.
+func (h *Host) sign(req Request) Request {
+	req.SenderAddr = h.Addr()
+	req.SenderId = h.id
+	req.Timestamp = time.Now().Unix()
+	copy(req.PublicKey[:], h.key.Public().(ed25519.PublicKey))
+
+	data, err := req.signedData()
+	if err == nil {
+		copy(req.Signature[:], ed25519.Sign(h.key, data))
+	}
+
+	return req
+}
+
+// Signe une réponse avec la clé du noeud local. La signature couvre
+// celle de la requête pour qu'une réponse ne puisse pas être rejouée.
+func (h *Host) signResponse(res Response, req Request) Response {
+	copy(res.PublicKey[:], h.key.Public().(ed25519.PublicKey))
+
+	data, err := res.signedData(req)
+	if err == nil {
+		copy(res.Signature[:], ed25519.Sign(h.key, data))
+	}
+
+	return res
+}
+
+// Indique si la requête est signée. Les noeuds antérieurs à
+// signedVersion ne signent pas leurs requêtes.
+func (r Request) isSigned() bool {
+	return r.Signature != [ed25519.SignatureSize]byte{}
+}
+
+// Vérifie que l'émetteur de la requête possède la clé privée associée
+// à SenderId et que la requête est récente.
+func (r Request) verify() bool {
+	if !r.isSigned() || !IdFromPublicKey(r.PublicKey[:]).Equal(r.SenderId) {
+		return false
+	}
+
+	skew := time.Since(time.Unix(r.Timestamp, 0))
+	if skew > maxClockSkew || skew < -maxClockSkew {
+		return false
+	}
+
+	data, err := r.signedData()
+	return err == nil && ed25519.Verify(r.PublicKey[:], data, r.Signature[:])
+}
+
+// Vérifie la signature d'une réponse à req et retourne l'identifiant
+// prouvé du noeud qui l'a émise. La deuxième valeur de retour est false
+// si la réponse n'est pas signée ou si sa signature est invalide.
+func (res Response) verify(req Request) (Id, bool) {
+	if res.Signature == [ed25519.SignatureSize]byte{} {
+		return Id{}, false
+	}
+
+	data, err := res.signedData(req)
+	if err != nil || !ed25519.Verify(res.PublicKey[:], data, res.Signature[:]) {
+		return Id{}, false
+	}
+
+	id := IdFromPublicKey(res.PublicKey[:])
+	if res.Type == PingRequestType && !res.Id.Equal(id) {
+		return Id{}, false
+	}
+
+	return id, true
+}
+
+// Retourne les données signées d'une requête : son encodage binaire non
+// signé suivi de sa date et de la clé publique de l'émetteur.
+func (r Request) signedData() ([]byte, error) {
+	data, err := binaryCodec{}.encodeRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	data = binary.BigEndian.AppendUint64(data, uint64(r.Timestamp))
+	return append(data, r.PublicKey[:]...), nil
+}
+
+// Retourne les données signées d'une réponse : son encodage binaire non
+// signé suivi de la signature de la requête.
+func (res Response) signedData(req Request) ([]byte, error) {
+	data, err := binaryCodec{}.encodeResponse(res)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(data, req.Signature[:]...), nil
+}
@@ -0,0 +1,113 @@
+package core
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"testing"
+	"time"
+)
+
+// Signe à nouveau une requête modifiée avec la clé du noeud.
+func resign(h *Host, req Request) Request {
+	data, _ := req.signedData()
+	copy(req.Signature[:], ed25519.Sign(h.key, data))
+	return req
+}
+
+func TestInvalidRequestSignatures(t *testing.T) {
+	h := NewHost("node-a", NewMemoryStorage(), WithTransport(NewMemoryTransport()))
+	sender := NewHost("node-b", NewMemoryStorage(), WithTransport(NewMemoryTransport()))
+
+	valid := sender.sign(newFindNodeRequest(Id{1}))
+	if !valid.verify() {
+		t.Fatal("Une requête correctement signée aurait dû être acceptée")
+	}
+
+	forged := valid
+	forged.Signature[0] ^= 1
+
+	tampered := valid
+	tampered.Id = Id{2}
+
+	otherId := valid
+	otherId.SenderId = h.id
+	otherId = resign(sender, otherId)
+
+	stale := valid
+	stale.Timestamp = time.Now().Add(-2 * maxClockSkew).Unix()
+	stale = resign(sender, stale)
+
+	future := valid
+	future.Timestamp = time.Now().Add(2 * maxClockSkew).Unix()
+	future = resign(sender, future)
+
+	for name, req := range map[string]Request{
+		"signature falsifiée":    forged,
+		"requête modifiée":       tampered,
+		"identifiant d'un autre": otherId,
+		"date trop ancienne":     stale,
+		"date trop éloignée":     future,
+	} {
+		if req.verify() {
+			t.Fatalf("Requête acceptée: %s", name)
+		}
+
+		if _, err := h.admitReq(req, memoryAddr("node-b")); !errors.Is(err, errInvalidSignature) {
+			t.Fatalf("La requête aurait dû être refusée (%s): %v", name, err)
+		}
+	}
+}
+
+func TestInvalidResponseSignatures(t *testing.T) {
+	h := NewHost("node-a", NewMemoryStorage(), WithTransport(NewMemoryTransport()))
+	responder := NewHost("node-b", NewMemoryStorage(), WithTransport(NewMemoryTransport()))
+
+	req := h.sign(newPingRequest())
+	res := responder.signResponse(Response{Type: PingRequestType, Id: responder.id}, req)
+
+	if id, ok := res.verify(req); !ok || !id.Equal(responder.id) {
+		t.Fatal("Une réponse correctement signée aurait dû être acceptée")
+	}
+
+	forged := res
+	forged.Signature[0] ^= 1
+	if _, ok := forged.verify(req); ok {
+		t.Fatal("Une réponse dont la signature est falsifiée aurait dû être refusée")
+	}
+
+	// Une réponse rejouée pour une autre requête.
+	if _, ok := res.verify(h.sign(newObservedAddrRequest())); ok {
+		t.Fatal("Une réponse à une autre requête aurait dû être refusée")
+	}
+
+	// Un ping dont l'identifiant annoncé n'est pas celui de la clé.
+	other := responder.signResponse(Response{Type: PingRequestType, Id: h.id}, req)
+	if _, ok := other.verify(req); ok {
+		t.Fatal("Un ping annonçant un autre identifiant aurait dû être refusé")
+	}
+}
+
+func TestStoreToUnexpectedPeer(t *testing.T) {
+	transport := NewMemoryTransport()
+	a := NewHost("node-a", NewMemoryStorage(), WithTransport(transport))
+	b := NewHost("node-b", NewMemoryStorage(), WithTransport(transport))
+
+	for _, host := range []*Host{a, b} {
+		if err := host.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer host.Stop()
+	}
+
+	ctx := context.Background()
+
+	if ok, err := a.storeTo(ctx, Peer{Id: b.id, Addr: b.Addr()}, Id{1}, Value{1}); !ok || err != nil {
+		t.Fatalf("Le stockage aurait dû réussir: %v", err)
+	}
+
+	impostor := Peer{Id: NewRandomId(), Addr: b.Addr()}
+	if _, err := a.storeTo(ctx, impostor, Id{2}, Value{2}); !errors.Is(err, errUnexpectedPeer) {
+		t.Fatalf("Une réponse d'un autre noeud que celui attendu aurait dû être refusée: %v", err)
+	}
+}
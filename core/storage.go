@@ -1,6 +1,7 @@
 package core
 
 import (
+	"log/slog"
 	"sync"
 	"time"
 )
@@ -12,15 +13,42 @@ type Value [ValueSize]byte
 type Storage interface {
 	Get(id Id) (Value, bool)
 	Set(id Id, value Value) bool
+
+	// Keys retourne les identifiants détenus et leur date d'expiration.
+	Keys() map[Id]time.Time
+}
+
+// Un ObservableStorage signale les valeurs qu'il retire. Un Host
+// utilisant un ObservableStorage publie ValueExpiredEvent, ainsi que
+// ValueEvictedEvent si le stockage retire des valeurs avant leur
+// expiration.
+type ObservableStorage interface {
+	Storage
+
+	// Observe enregistre une fonction appelée pour chaque valeur
+	// retirée. La fonction ne doit pas bloquer.
+	Observe(fn func(Event))
 }
 
-// MemoryStorage est un Storage en mémoire.
+// Un ExpiringStorage retire ses valeurs expirées à l'appel de
+// RemoveExpired. Un Host l'appelle périodiquement tant qu'il est démarré.
+type ExpiringStorage interface {
+	Storage
+	RemoveExpired()
+}
+
+// MemoryStorage est un Storage en mémoire. Lorsqu'il est plein, les
+// nouvelles valeurs sont refusées. Une valeur
+// expirée n'est plus retournée par Get ; elle est retirée par
+// RemoveExpired.
 type MemoryStorage struct {
-	data   map[Id]ValueWithExpiry
-	mu     sync.Mutex
-	size   int
-	cancel chan struct{}
-	wg     sync.WaitGroup
+	data      map[Id]ValueWithExpiry
+	mu        sync.Mutex
+	size      int
+	ttl       time.Duration // durée de vie d'une valeur
+	capacity  int           // nombre de valeurs maximal
+	observers []func(Event)
+	logger    *slog.Logger
 }
 
 type ValueWithExpiry struct {
@@ -28,30 +56,34 @@ type ValueWithExpiry struct {
 	ExpireAt time.Time
 }
 
+// Crée un MemoryStorage avec la configuration par défaut.
 func NewMemoryStorage() *MemoryStorage {
-	ms := &MemoryStorage{
-		data:   make(map[Id]ValueWithExpiry),
-		cancel: make(chan struct{}),
-	}
-
-	ms.wg.Add(1)
-	go ms.cleanupExpired()
-
-	return ms
+	return NewMemoryStorageWithConfig(DefaultConfig())
 }
 
-// Arrête le processus de suppression des valeurs expirées.
-func (s *MemoryStorage) Close() {
-	close(s.cancel)
-	s.wg.Wait()
+// Crée un MemoryStorage utilisant StorageTtl et StorageCapacity. La
+// configuration doit être valide, voir Config.Validate.
+func NewMemoryStorageWithConfig(config Config) *MemoryStorage {
+	return &MemoryStorage{
+		data:     make(map[Id]ValueWithExpiry),
+		ttl:      config.StorageTtl,
+		capacity: config.StorageCapacity,
+		logger:   slog.New(slog.DiscardHandler),
+	}
 }
 
+// Close ne fait rien.
+//
+// Deprecated: les valeurs expirées sont retirées par le Host utilisant le
+// MemoryStorage, ou par un appel à RemoveExpired.
+func (s *MemoryStorage) Close() {}
+
 func (s *MemoryStorage) Get(id Id) (Value, bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	item, exists := s.data[id]
-	if !exists {
+	if !exists || time.Now().After(item.ExpireAt) {
 		return Value{}, false
 	}
 
@@ -62,21 +94,84 @@ func (s *MemoryStorage) Set(id Id, value Value) bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if s.size >= storageCapacity {
+	_, exists := s.data[id]
+	if !exists && s.size >= s.capacity {
+		s.logger.Warn("store rejected, storage full", "id", id)
 		return false
 	}
 
+	// Stocker à nouveau une valeur existante repousse son expiration.
 	s.data[id] = ValueWithExpiry{
 		Value:    value,
-		ExpireAt: time.Now().Add(storageTtl),
+		ExpireAt: time.Now().Add(s.ttl),
 	}
 
-	s.size += 1
+	if !exists {
+		s.size += 1
+	}
 
 	return true
 }
 
+// Retire les valeurs expirées.
+func (s *MemoryStorage) RemoveExpired() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	expired := 0
+
+	for id, item := range s.data {
+		if now.After(item.ExpireAt) {
+			delete(s.data, id)
+			s.size -= 1
+			expired++
+			s.notifyLocked(Event{Type: ValueExpiredEvent, Id: id})
+		}
+	}
+
+	if expired > 0 {
+		s.logger.Debug("values expired", "count", expired, "remaining", s.size)
+	}
+}
+
+// Journalise les opérations du stockage avec logger.
+func (s *MemoryStorage) SetLogger(logger *slog.Logger) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.logger = logger
+}
+
+func (s *MemoryStorage) Observe(fn func(Event)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.observers = append(s.observers, fn)
+}
+
+func (s *MemoryStorage) notifyLocked(e Event) {
+	for _, fn := range s.observers {
+		fn(e)
+	}
+}
+
+func (s *MemoryStorage) Keys() map[Id]time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make(map[Id]time.Time, len(s.data))
+	for id, item := range s.data {
+		keys[id] = item.ExpireAt
+	}
+
+	return keys
+}
+
 func (s *MemoryStorage) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	return s.size
 }
 
@@ -94,29 +189,7 @@ func (*FakeStorage) Get(id Id) (Value, bool) {
 func (*FakeStorage) Set(id Id, value Value) bool {
 	return false
 }
-func (s *MemoryStorage) cleanupExpired() {
-	defer s.wg.Done()
 
-	ticker := time.NewTicker(storageTtl / 5)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ticker.C:
-			s.mu.Lock()
-			now := time.Now()
-
-			for id, item := range s.data {
-				if now.After(item.ExpireAt) {
-					delete(s.data, id)
-					s.size -= 1
-				}
-			}
-
-			s.mu.Unlock()
-
-		case <-s.cancel:
-			return
-		}
-	}
+func (*FakeStorage) Keys() map[Id]time.Time {
+	return map[Id]time.Time{}
 }
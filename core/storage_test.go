@@ -0,0 +1,66 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStorageExpiry(t *testing.T) {
+	config := DefaultConfig()
+	config.StorageTtl = 10 * time.Millisecond
+
+	s := NewMemoryStorageWithConfig(config)
+	defer s.Close()
+
+	s.Set(Id{1}, Value{1})
+	if _, ok := s.Get(Id{1}); !ok {
+		t.Fatal("La valeur aurait dû être retournée avant son expiration")
+	}
+
+	// Sans appel à RemoveExpired, la valeur expirée ne doit plus être
+	// retournée.
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, ok := s.Get(Id{1}); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("La valeur expirée n'aurait pas dû être retournée")
+		}
+		time.Sleep(config.StorageTtl)
+	}
+
+	s.RemoveExpired()
+	if s.Len() != 0 {
+		t.Fatalf("La valeur expirée aurait dû être retirée: %d valeurs", s.Len())
+	}
+}
+
+func TestMemoryStorageFull(t *testing.T) {
+	config := DefaultConfig()
+	config.StorageCapacity = 2
+
+	s := NewMemoryStorageWithConfig(config)
+
+	var events []Event
+	s.Observe(func(e Event) { events = append(events, e) })
+
+	if !s.Set(Id{1}, Value{1}) || !s.Set(Id{2}, Value{2}) {
+		t.Fatal("Les valeurs auraient dû être stockées")
+	}
+
+	if s.Set(Id{3}, Value{3}) {
+		t.Fatal("Le stockage plein aurait dû refuser une nouvelle valeur")
+	}
+	if _, ok := s.Get(Id{1}); !ok {
+		t.Fatal("Aucune valeur n'aurait dû être retirée du stockage plein")
+	}
+	if len(events) != 0 {
+		t.Fatalf("Aucun événement n'aurait dû être publié: %v", events)
+	}
+
+	// Stocker à nouveau une valeur existante reste possible.
+	if !s.Set(Id{1}, Value{1}) {
+		t.Fatal("Une valeur existante aurait dû être stockée à nouveau")
+	}
+}
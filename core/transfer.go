@@ -0,0 +1,120 @@
+package core
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Nombre de parcours des valeurs locales autorisés par bucket lors de
+// l'arrivée de nouveaux noeuds. Au-delà, les noeuds du bucket reçoivent
+// les valeurs lors de la réplication suivante.
+var transferScanLimit = RateLimit{Rate: 1, Burst: 4}
+
+// Demande la transmission au noeud des valeurs dont il fait désormais
+// partie des plus proches. Chaque transmission parcourt les valeurs
+// locales, leur nombre est donc limité par bucket, voir
+// transferScanLimit. Si le bucket du noeud a atteint sa limite ou si
+// trop de transmissions sont déjà en attente, la demande est ignorée.
+func (h *Host) scheduleTransfer(peer Peer) {
+	if _, ok := h.transferScans.allow(strconv.Itoa(h.rt.bucketIndex(peer.Id)), time.Now()); !ok {
+		h.log.storage.Debug("transfer skipped, bucket rate limited", "peer", peer)
+		return
+	}
+
+	select {
+	case h.transfers <- peer:
+	default:
+	}
+}
+
+func (h *Host) startTransfer() {
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+
+		// Limite le débit des transmissions pour ne pas saturer le
+		// réseau lorsque de nombreux noeuds rejoignent le réseau.
+		ticker := time.NewTicker(time.Second / time.Duration(h.config.TransferRate))
+		defer ticker.Stop()
+
+		for {
+			select {
+			case peer := <-h.transfers:
+				h.transferKeys(peer, ticker)
+			case <-h.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Transmet au noeud les valeurs stockées localement dont il est plus
+// proche que le noeud local et pour lesquelles il fait partie des
+// MaxReplicasCount noeuds connus les plus proches.
+func (h *Host) transferKeys(peer Peer, ticker *time.Ticker) {
+	peers := append(h.rt.peers(), Peer{Id: h.id, Addr: h.Addr()})
+
+	for id := range h.storage.Keys() {
+		if !peer.Id.Distance(id).Less(h.id.Distance(id)) {
+			continue
+		}
+
+		if !isAmongClosest(peer, peers, id, h.config.MaxReplicasCount) {
+			continue
+		}
+
+		value, ok := h.storage.Get(id)
+		if !ok {
+			continue
+		}
+
+		select {
+		case <-ticker.C:
+		case <-h.ctx.Done():
+			return
+		}
+
+		if !h.transferValue(peer, id, value) {
+			return
+		}
+	}
+}
+
+// Transmet une valeur au noeud. Si le noeud est surchargé, la valeur est
+// transmise à nouveau après le délai qu'il demande. Retourne false si
+// le noeud local s'arrête.
+func (h *Host) transferValue(peer Peer, id Id, value Value) bool {
+	for {
+		_, err := h.storeTo(h.ctx, peer, id, value)
+
+		var busy *BusyError
+		if !errors.As(err, &busy) {
+			return true
+		}
+
+		select {
+		case <-time.After(busy.RetryAfter):
+		case <-h.ctx.Done():
+			return false
+		}
+	}
+}
+
+// Indique si le noeud fait partie des n noeuds de la liste les plus
+// proches de id.
+func isAmongClosest(peer Peer, peers []Peer, id Id, n int) bool {
+	dist := peer.Id.Distance(id)
+	closerCount := 0
+
+	for _, other := range peers {
+		if other.Id.Distance(id).Less(dist) {
+			closerCount++
+			if closerCount >= n {
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,137 @@
+package core
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// Un Transport établit les connexions entre les noeuds du réseau.
+// Un Transport doit être sûr pour une utilisation concurrente.
+type Transport interface {
+	// Listen attend les connexions entrantes à l'adresse addr.
+	Listen(addr string) (net.Listener, error)
+	// Dial ouvre une connexion vers le noeud[addr].
+	Dial(addr string, timeout time.Duration) (net.Conn, error)
+}
+
+// TCPTransport est le Transport par défaut, il utilise des connexions TCP.
+type TCPTransport struct{}
+
+func NewTCPTransport() *TCPTransport {
+	return &TCPTransport{}
+}
+
+func (*TCPTransport) Listen(addr string) (net.Listener, error) {
+	return net.Listen("tcp", addr)
+}
+
+func (*TCPTransport) Dial(addr string, timeout time.Duration) (net.Conn, error) {
+	return net.DialTimeout("tcp", addr, timeout)
+}
+
+var errNoListener = errors.New("no listener at address")
+
+// MemoryTransport est un Transport en mémoire qui relie les noeuds d'un
+// même processus sans passer par le réseau. Tous les noeuds partageant
+// un MemoryTransport forment un même réseau, les adresses peuvent être
+// des chaînes quelconques.
+type MemoryTransport struct {
+	listeners map[string]*memoryListener
+	mu        sync.Mutex
+}
+
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{
+		listeners: make(map[string]*memoryListener),
+	}
+}
+
+func (t *MemoryTransport) Listen(addr string) (net.Listener, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.listeners[addr]; ok {
+		return nil, errors.New("address already in use")
+	}
+
+	l := &memoryListener{
+		transport: t,
+		addr:      memoryAddr(addr),
+		conns:     make(chan net.Conn),
+		done:      make(chan struct{}),
+	}
+	t.listeners[addr] = l
+
+	return l, nil
+}
+
+func (t *MemoryTransport) Dial(addr string, timeout time.Duration) (net.Conn, error) {
+	t.mu.Lock()
+	l, ok := t.listeners[addr]
+	t.mu.Unlock()
+
+	if !ok {
+		return nil, errNoListener
+	}
+
+	client, server := net.Pipe()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.done:
+		return nil, errNoListener
+	case <-timer.C:
+		return nil, ErrTimeout
+	}
+}
+
+// memoryListener est un net.Listener créé par MemoryTransport.
+type memoryListener struct {
+	transport *MemoryTransport
+	addr      memoryAddr
+	conns     chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (l *memoryListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *memoryListener) Close() error {
+	l.closeOnce.Do(func() {
+		l.transport.mu.Lock()
+		delete(l.transport.listeners, string(l.addr))
+		l.transport.mu.Unlock()
+
+		close(l.done)
+	})
+
+	return nil
+}
+
+func (l *memoryListener) Addr() net.Addr {
+	return l.addr
+}
+
+// memoryAddr est l'adresse d'un noeud sur un MemoryTransport.
+type memoryAddr string
+
+func (memoryAddr) Network() string {
+	return "memory"
+}
+
+func (a memoryAddr) String() string {
+	return string(a)
+}
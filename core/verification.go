@@ -0,0 +1,193 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+var errAddrUnknown = errors.New("peer could not observe our address")
+
+// pendingPeers contient les émetteurs dont l'adresse est en cours de
+// vérification, ainsi que les adresses déjà vérifiées.
+type pendingPeers struct {
+	peers    map[Id]struct{}
+	hosts    map[string]struct{} // adresses observées dont l'émetteur prétend avoir une autre adresse
+	verified map[Id]verifiedAddr // adresses ayant répondu à un ping-back
+}
+
+type verifiedAddr struct {
+	addr  string
+	until time.Time
+}
+
+func newPendingPeers() pendingPeers {
+	return pendingPeers{
+		peers:    make(map[Id]struct{}),
+		hosts:    make(map[string]struct{}),
+		verified: make(map[Id]verifiedAddr),
+	}
+}
+
+// Ajoute l'émetteur d'une requête à la table de routage. Un émetteur
+// dont l'adresse n'a pas été vérifiée récemment est mis en attente et
+// n'est ajouté qu'après avoir répondu à un ping-back à l'adresse qu'il
+// annonce. Si l'adresse observée ne correspond pas à l'adresse
+// annoncée, une seule vérification à la fois est effectuée pour
+// l'adresse observée, pour qu'un émetteur ne puisse pas faire pinger
+// des adresses quelconques. Aucune vérification n'a lieu si le noeud
+// local n'est pas démarré.
+func (h *Host) admitPeer(peer Peer, observed net.Addr) {
+	if peer.Id.Equal(h.id) {
+		return
+	}
+
+	if h.rt.contains(peer) || h.isVerified(peer) {
+		h.addPeer(peer)
+		return
+	}
+
+	host, mismatch := addrMismatch(peer.Addr, observed)
+
+	h.pendingMu.Lock()
+	defer h.pendingMu.Unlock()
+
+	if _, ok := h.pending.peers[peer.Id]; ok || len(h.pending.peers) >= maxPendingPeers {
+		return
+	}
+
+	if mismatch {
+		if _, ok := h.pending.hosts[host]; ok {
+			return
+		}
+	}
+
+	started := h.goBackground(func(ctx context.Context) {
+		id, err := h.pingPeer(ctx, peer.Addr)
+		ok := err == nil && id.Equal(peer.Id)
+		if !ok && ctx.Err() == nil {
+			h.log.routing.Debug("address verification failed", "peer", peer, "observed", observed, "err", err)
+		}
+
+		h.pendingMu.Lock()
+		delete(h.pending.peers, peer.Id)
+		if mismatch {
+			delete(h.pending.hosts, host)
+		}
+		if ok {
+			h.pending.verified[peer.Id] = verifiedAddr{
+				addr:  peer.Addr,
+				until: time.Now().Add(verifiedAddrTtl),
+			}
+		}
+		h.pendingMu.Unlock()
+
+		if ok {
+			h.addPeer(peer)
+		}
+	})
+
+	if started {
+		if mismatch {
+			h.pending.hosts[host] = struct{}{}
+		}
+		h.pending.peers[peer.Id] = struct{}{}
+	}
+}
+
+// Indique si l'adresse du noeud a répondu récemment à un ping-back.
+func (h *Host) isVerified(peer Peer) bool {
+	h.pendingMu.Lock()
+	defer h.pendingMu.Unlock()
+
+	v, ok := h.pending.verified[peer.Id]
+	return ok && v.addr == peer.Addr && time.Now().Before(v.until)
+}
+
+// Oublie les adresses vérifiées depuis plus de verifiedAddrTtl.
+func (h *Host) pruneVerified() {
+	h.pendingMu.Lock()
+	defer h.pendingMu.Unlock()
+
+	now := time.Now()
+	for id, v := range h.pending.verified {
+		if now.After(v.until) {
+			delete(h.pending.verified, id)
+		}
+	}
+}
+
+// Compare l'adresse annoncée par un émetteur à l'adresse depuis laquelle
+// sa requête a été reçue. Retourne l'hôte observé et true si les deux
+// ne correspondent pas. Une adresse observée sans IP, par exemple sur
+// un MemoryTransport, correspond à toute adresse annoncée.
+func addrMismatch(claimed string, observed net.Addr) (string, bool) {
+	ip := observedIp(observed)
+	if ip == nil {
+		return "", false
+	}
+
+	host := ip.String()
+
+	claimedHost, _, err := net.SplitHostPort(claimed)
+	if err != nil {
+		return host, true
+	}
+
+	claimedIp := net.ParseIP(claimedHost)
+	return host, claimedIp == nil || !claimedIp.Equal(ip)
+}
+
+// Retourne l'adresse observée d'un émetteur telle qu'elle lui est
+// communiquée en réponse à ObservedAddrRequestType, ou une chaîne vide
+// si elle ne contient pas d'IP.
+func observedAddr(observed net.Addr) string {
+	if observedIp(observed) == nil {
+		return ""
+	}
+	return observed.String()
+}
+
+func observedIp(observed net.Addr) net.IP {
+	switch addr := observed.(type) {
+	case *net.TCPAddr:
+		return addr.IP
+	case *net.UDPAddr:
+		return addr.IP
+	default:
+		return nil
+	}
+}
+
+// Demande au noeud[addr] l'adresse depuis laquelle il voit le noeud
+// local et annonce désormais cette IP avec le port d'écoute. Le port
+// observé est celui de la connexion sortante et n'est pas conservé.
+func (h *Host) discoverAdvertisedAddr(ctx context.Context, addr string) error {
+	observed, err := h.observedAddrFrom(ctx, addr)
+	if err != nil {
+		return err
+	}
+
+	if observed == "" {
+		return errAddrUnknown
+	}
+
+	host, _, err := net.SplitHostPort(observed)
+	if err != nil {
+		return err
+	}
+
+	_, port, err := net.SplitHostPort(h.addr)
+	if err != nil {
+		return err
+	}
+
+	h.advertisedMu.Lock()
+	h.advertisedAddr = net.JoinHostPort(host, port)
+	h.advertisedMu.Unlock()
+
+	h.log.host.Info("advertised address discovered", "addr", h.Addr(), "bootstrap", addr)
+
+	return nil
+}
@@ -6,6 +6,7 @@
 package data
 
 import (
+	"context"
 	"encoding/binary"
 
 	"github.com/mattesthaut/gdfs/core"
@@ -34,11 +35,45 @@ type node struct {
 // de son identifiant. La deuxième valeur de retour est true si
 // et seulement si la donnée a été intégralement retrouvée.
 func FindData(id core.Id, reader Reader) ([]byte, bool) {
+	return FindDataContext(context.Background(), id, reader)
+}
+
+// Comme FindData, mais la recherche est abandonnée à l'annulation de
+// ctx. Les requêtes en cours ne sont interrompues que si le Reader est
+// un ContextReader.
+func FindDataContext(ctx context.Context, id core.Id, reader Reader) ([]byte, bool) {
+	data, err := Retrieve(ctx, id, reader)
+	if err != nil {
+		return []byte{}, false
+	}
+	return data, true
+}
+
+// Comme FindDataContext, mais retourne la raison de l'échec. Si la
+// racine est introuvable, l'erreur est celle du Reader, par exemple
+// core.ErrNotFound ou core.ErrNoPeers pour un core.Host. Si des noeuds
+// de l'arbre sont introuvables, l'erreur est un *PartialTreeError. Si la
+// recherche d'un noeud de l'arbre échoue pour une autre raison, l'erreur
+// est celle du Reader.
+func Retrieve(ctx context.Context, id core.Id, reader Reader) ([]byte, error) {
 	pr := NewParallelReader(reader)
-	if root, found := reader.FindValue(id); found {
-		return join(root, pr)
+
+	root, err := pr.retrieve(ctx, id)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	missing := make([]core.Id, 0)
+	data, err := join(ctx, root, pr, &missing)
+	if err != nil {
+		return []byte{}, err
 	}
-	return []byte{}, false
+
+	if len(missing) > 0 {
+		return []byte{}, &PartialTreeError{Id: id, Missing: missing}
+	}
+
+	return data, nil
 }
 
 // Stocke une donnée de taille quelconque et renvoie son identifiant.
@@ -46,9 +81,24 @@ func FindData(id core.Id, reader Reader) ([]byte, bool) {
 // stockés. Si le nombre de replicas est nul, alors la donnée n’a pas
 // été correctement stockée.
 func StoreData(data []byte, writer Writer) (core.Id, int) {
+	return StoreDataContext(context.Background(), data, writer)
+}
+
+// Comme StoreData, mais le stockage est abandonné à l'annulation de
+// ctx, auquel cas le nombre de replicas retourné est nul.
+func StoreDataContext(ctx context.Context, data []byte, writer Writer) (core.Id, int) {
+	id, replicas, _ := Publish(ctx, data, writer)
+	return id, replicas
+}
+
+// Comme StoreDataContext, mais retourne la raison de l'échec : l'erreur
+// du premier noeud de l'arbre qui n'a pas pu être stocké, par exemple
+// un *core.InsufficientReplicasError pour un core.Host.
+func Publish(ctx context.Context, data []byte, writer Writer) (core.Id, int, error) {
 	pw := NewParallelWriter(writer)
 	id, values := Split(data)
-	return id, pw.StoreValues(values)
+	replicas, err := pw.PublishValues(ctx, values)
+	return id, replicas, err
 }
 
 // Découpe une donnée de taille quelconque en un arbre et renvoie
@@ -60,14 +110,25 @@ func Split(data []byte) (core.Id, []core.Value) {
 }
 
 // Reconstruit la donnée initiale à partir d’un arbre sous forme de
-// liste de Value. La deuxième valeur de retour représente la
-// réussite de l’opération.
-func join(value core.Value, reader *ParallelReader) ([]byte, bool) {
+// liste de Value. Les identifiants des noeuds introuvables sont ajoutés
+// à missing, et les sous-arbres correspondants sont ignorés.
+func join(ctx context.Context, value core.Value, reader *ParallelReader, missing *[]core.Id) ([]byte, error) {
 	isLeaf := value[0] == 1
 	size := int32(binary.BigEndian.Uint32(value[1:5]))
 
+	if value[0] > 1 || size < 0 {
+		return nil, ErrMalformedNode
+	}
+
 	if isLeaf {
-		return value[headerSize : headerSize+size], true
+		if size > payloadSize {
+			return nil, ErrMalformedNode
+		}
+		return value[headerSize : headerSize+size], nil
+	}
+
+	if size > maxChildren {
+		return nil, ErrMalformedNode
 	}
 
 	ids := make([]core.Id, size)
@@ -76,22 +137,32 @@ func join(value core.Value, reader *ParallelReader) ([]byte, bool) {
 		copy(ids[i][:], value[s:s+core.IdSize])
 	}
 
-	values, found := reader.FindValues(ids)
-	if !found {
-		return []byte{}, false
+	values, notFound, err := reader.RetrieveValues(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	*missing = append(*missing, notFound...)
+
+	absent := make(map[core.Id]bool, len(notFound))
+	for _, id := range notFound {
+		absent[id] = true
 	}
 
 	data := make([]byte, 0)
 	for i := range values {
-		childData, found := join(values[i], reader)
-		if !found {
-			return []byte{}, false
+		if absent[ids[i]] {
+			continue
+		}
+
+		childData, err := join(ctx, values[i], reader, missing)
+		if err != nil {
+			return nil, err
 		}
 
 		data = append(data, childData...)
 	}
 
-	return data, true
+	return data, nil
 }
 
 // Construit les noeuds internes de l’arbre à partir des feuilles.
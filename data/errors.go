@@ -0,0 +1,41 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/mattesthaut/gdfs/core"
+)
+
+var (
+	// Un noeud de l'arbre ne respecte pas le format attendu.
+	ErrMalformedNode = errors.New("malformed tree node")
+	// Des noeuds de l'arbre sont introuvables, voir PartialTreeError.
+	ErrPartialTree = errors.New("partial tree")
+)
+
+// PartialTreeError indique que la racine d'une donnée a été trouvée,
+// mais pas certains de ses noeuds.
+type PartialTreeError struct {
+	Id      core.Id   // identifiant de la donnée
+	Missing []core.Id // identifiants des noeuds introuvables
+}
+
+func (e *PartialTreeError) Error() string {
+	return fmt.Sprintf("%s: %d missing chunks", e.Id, len(e.Missing))
+}
+
+func (e *PartialTreeError) Unwrap() error {
+	return ErrPartialTree
+}
+
+// Retourne l'erreur d'un contexte annulé. Un délai dépassé satisfait
+// aussi errors.Is(err, core.ErrTimeout).
+func contextError(ctx context.Context) error {
+	err := ctx.Err()
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", core.ErrTimeout, err)
+	}
+	return err
+}
@@ -1,6 +1,8 @@
 package data
 
 import (
+	"context"
+	"errors"
 	"sync"
 
 	"github.com/mattesthaut/gdfs/core"
@@ -22,6 +24,40 @@ type Writer interface {
 	StoreValue(value core.Value) (core.Id, int)
 }
 
+// Un ContextReader est un Reader dont les recherches peuvent être
+// annulées. core.Host est un ContextReader.
+type ContextReader interface {
+	Reader
+	// FindValueContext doit être sûre pour une utilisation concurrente
+	// et s'arrêter rapidement à l'annulation de ctx.
+	FindValueContext(ctx context.Context, id core.Id) (core.Value, bool)
+}
+
+// Un ContextWriter est un Writer dont les stockages peuvent être
+// annulés. core.Host est un ContextWriter.
+type ContextWriter interface {
+	Writer
+	// StoreValueContext doit être sûre pour une utilisation concurrente
+	// et s'arrêter rapidement à l'annulation de ctx.
+	StoreValueContext(ctx context.Context, value core.Value) (core.Id, int)
+}
+
+// Un Retriever est un ContextReader qui indique pourquoi une valeur n'a
+// pas été trouvée. core.Host est un Retriever.
+type Retriever interface {
+	ContextReader
+	// Retrieve doit être sûre pour une utilisation concurrente.
+	Retrieve(ctx context.Context, id core.Id) (core.Value, error)
+}
+
+// Un Publisher est un ContextWriter qui indique pourquoi une valeur n'a
+// pas été stockée. core.Host est un Publisher.
+type Publisher interface {
+	ContextWriter
+	// Publish doit être sûre pour une utilisation concurrente.
+	Publish(ctx context.Context, value core.Value) (core.Id, int, error)
+}
+
 // Un ParallelReader permet de paralléliser les opérations
 // de lecture sur un Reader.
 type ParallelReader struct {
@@ -58,10 +94,29 @@ func NewParallelWriter(writer Writer) *ParallelWriter {
 // dans le même ordre. La deuxième valeur de retour est true si
 // et seulement si toutes les valeurs ont été trouvées.
 func (pr *ParallelReader) FindValues(ids []core.Id) ([]core.Value, bool) {
+	return pr.FindValuesContext(context.Background(), ids)
+}
+
+// Comme FindValues, mais les recherches sont abandonnées à l'annulation
+// de ctx. Les recherches ne sont interrompues en cours que si le Reader
+// est un ContextReader.
+func (pr *ParallelReader) FindValuesContext(ctx context.Context, ids []core.Id) ([]core.Value, bool) {
+	values, missing, err := pr.RetrieveValues(ctx, ids)
+	return values, err == nil && len(missing) == 0
+}
+
+// Cherche les valeurs associées aux identifiants et les retourne dans
+// le même ordre, ainsi que les identifiants des valeurs introuvables.
+// Retourne l'erreur de ctx s'il est annulé, ou la première erreur autre
+// que core.ErrNotFound retournée par le Reader, par exemple
+// core.ErrNoPeers pour un core.Host.
+func (pr *ParallelReader) RetrieveValues(ctx context.Context, ids []core.Id) ([]core.Value, []core.Id, error) {
 	results := make([]core.Value, len(ids))
+	found := make([]bool, len(ids))
 
 	var wg sync.WaitGroup
-	allFound := true
+	var mu sync.Mutex
+	var firstErr error
 
 	for i, id := range ids {
 		wg.Add(1)
@@ -69,26 +124,92 @@ func (pr *ParallelReader) FindValues(ids []core.Id) ([]core.Value, bool) {
 		go func(index int, id core.Id) {
 			defer wg.Done()
 
-			pr.sem <- struct{}{}
+			select {
+			case pr.sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
 			defer func() { <-pr.sem }()
 
-			if value, found := pr.reader.FindValue(id); found {
-				results[i] = value
-			} else {
-				allFound = false
+			value, err := pr.retrieve(ctx, id)
+			if err == nil {
+				results[index] = value
+				found[index] = true
+			} else if !errors.Is(err, core.ErrNotFound) {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
 			}
 		}(i, id)
 	}
 
 	wg.Wait()
-	return results, allFound
+
+	if ctx.Err() != nil {
+		return results, nil, contextError(ctx)
+	}
+
+	if firstErr != nil {
+		return results, nil, firstErr
+	}
+
+	missing := make([]core.Id, 0)
+	for i, id := range ids {
+		if !found[i] {
+			missing = append(missing, id)
+		}
+	}
+
+	return results, missing, nil
+}
+
+func (pr *ParallelReader) retrieve(ctx context.Context, id core.Id) (core.Value, error) {
+	switch reader := pr.reader.(type) {
+	case Retriever:
+		return reader.Retrieve(ctx, id)
+	case ContextReader:
+		if value, found := reader.FindValueContext(ctx, id); found {
+			return value, nil
+		}
+	default:
+		if ctx.Err() != nil {
+			return core.Value{}, contextError(ctx)
+		}
+		if value, found := reader.FindValue(id); found {
+			return value, nil
+		}
+	}
+
+	if ctx.Err() != nil {
+		return core.Value{}, contextError(ctx)
+	}
+	return core.Value{}, core.ErrNotFound
 }
 
 // Stocke les paires identifiant-valeur et retourne true si
 // toutes les paires ont été stockées, sinon false.
 func (pr *ParallelWriter) StoreValues(values []core.Value) int {
+	return pr.StoreValuesContext(context.Background(), values)
+}
+
+// Comme StoreValues, mais les stockages sont abandonnés à l'annulation
+// de ctx, auquel cas le nombre de replicas retourné est nul. Les
+// stockages ne sont interrompus en cours que si le Writer est un
+// ContextWriter.
+func (pr *ParallelWriter) StoreValuesContext(ctx context.Context, values []core.Value) int {
+	replicas, _ := pr.PublishValues(ctx, values)
+	return replicas
+}
+
+// Stocke les valeurs et retourne le plus petit nombre de replicas
+// stockés pour une valeur, ainsi que la première erreur rencontrée.
+// Si ctx est annulé, le nombre de replicas retourné est nul.
+func (pr *ParallelWriter) PublishValues(ctx context.Context, values []core.Value) (int, error) {
 	var wg sync.WaitGroup
 	var mu sync.Mutex
+	var firstErr error
 	replicas := 1000
 
 	for _, value := range values {
@@ -97,17 +218,50 @@ func (pr *ParallelWriter) StoreValues(values []core.Value) int {
 		go func(value core.Value) {
 			defer wg.Done()
 
-			pr.sem <- struct{}{}
+			select {
+			case pr.sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
 			defer func() { <-pr.sem }()
 
-			_, r := pr.writer.StoreValue(value)
+			_, r, err := pr.publish(ctx, value)
 
 			mu.Lock()
 			defer mu.Unlock()
 			replicas = min(replicas, r)
+			if firstErr == nil {
+				firstErr = err
+			}
 		}(value)
 	}
 
 	wg.Wait()
-	return replicas
+
+	if ctx.Err() != nil {
+		return 0, contextError(ctx)
+	}
+	return replicas, firstErr
+}
+
+func (pr *ParallelWriter) publish(ctx context.Context, value core.Value) (core.Id, int, error) {
+	var id core.Id
+	var replicas int
+
+	switch writer := pr.writer.(type) {
+	case Publisher:
+		return writer.Publish(ctx, value)
+	case ContextWriter:
+		id, replicas = writer.StoreValueContext(ctx, value)
+	default:
+		if ctx.Err() != nil {
+			return core.Id{}, 0, contextError(ctx)
+		}
+		id, replicas = writer.StoreValue(value)
+	}
+
+	if replicas == 0 {
+		return id, 0, &core.InsufficientReplicasError{Id: id, Required: 1}
+	}
+	return id, replicas, nil
 }
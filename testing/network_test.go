@@ -1,9 +1,16 @@
 package test
 
 import (
+	"bytes"
+	"context"
 	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
 	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/mattesthaut/gdfs/core"
 	"github.com/mattesthaut/gdfs/data"
@@ -11,6 +18,9 @@ import (
 
 const (
 	nodeCount       = 200
+	smallNodeCount  = 20
+	tcpNodeCount    = 50
+	udpRatio        = 2
 	disconnectRatio = 4
 	randomDataSize  = core.ValueSize * 100
 	testFileSrc     = "test.txt"
@@ -90,3 +100,772 @@ func TestWithFile(t *testing.T) {
 		t.Logf("Les données ont été écrites dans %s", testFileDest)
 	}
 }
+
+func TestTCPNetwork(t *testing.T) {
+	hosts := newTCPNetwork(t, tcpNodeCount, basePort, 0)
+	defer destroyNetwork(hosts)
+
+	storeAndRetrieve(t, hosts)
+}
+
+func TestMixedNetwork(t *testing.T) {
+	hosts := newTCPNetwork(t, tcpNodeCount, mixedBasePort, udpRatio)
+	defer destroyNetwork(hosts)
+
+	storeAndRetrieve(t, hosts)
+}
+
+func TestIncompatibleNetwork(t *testing.T) {
+	transport := core.NewMemoryTransport()
+
+	host := core.NewHost("node-a", core.NewMemoryStorage(), core.WithTransport(transport))
+	if err := host.Start(); err != nil {
+		t.Fatalf("Erreur lors du démarrage du noeud: %v", err)
+	}
+	defer host.Stop()
+
+	other := core.NewHost(
+		"node-b",
+		core.NewMemoryStorage(),
+		core.WithTransport(transport),
+		core.WithNetworkId("autre"),
+	)
+
+	err := other.Bootstrap(host.Addr())
+	if !errors.Is(err, core.ErrIncompatiblePeer) {
+		t.Fatalf("Le noeud d'un autre réseau aurait dû être refusé: %v", err)
+	}
+
+	t.Logf("Le noeud d'un autre réseau a été refusé: %v", err)
+}
+
+// Stocke une donnée aléatoire depuis le premier noeud et la récupère
+// depuis le dernier.
+func storeAndRetrieve(t *testing.T, hosts []*core.Host) {
+	networkStats(t, hosts)
+
+	t.Logf("Création d'une donnée aléatoire de %d octets", randomDataSize)
+	randomData := make([]byte, randomDataSize)
+	if _, err := rand.Read(randomData[:]); err != nil {
+		t.Fatalf("Erreur lors de la création de la donnée de test: %v", err)
+	}
+
+	id := store(t, hosts, 0, randomData)
+
+	retrievalNodeId := len(hosts) - 1
+
+	t.Logf("Récupération de la donnée aléatoire depuis le noeud %d", retrievalNodeId)
+	retrievedData, found := data.FindData(id, hosts[retrievalNodeId])
+
+	if !found {
+		t.Error("La donnée n'a pas été trouvée")
+	} else if !slices.Equal(retrievedData, randomData) {
+		t.Error("La donnée récupérée ne correspond pas à l'original")
+	} else {
+		t.Log("La donnée a été récupérée et correspond à l'original")
+	}
+}
+
+func TestCanceledRetrieval(t *testing.T) {
+	hosts := newNetwork(t, smallNodeCount)
+	defer destroyNetwork(hosts)
+
+	randomData := make([]byte, randomDataSize)
+	if _, err := rand.Read(randomData[:]); err != nil {
+		t.Fatalf("Erreur lors de la création de la donnée de test: %v", err)
+	}
+
+	id := store(t, hosts, 0, randomData)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := data.Retrieve(ctx, id, hosts[len(hosts)-1]); !errors.Is(err, context.Canceled) {
+		t.Fatalf("La recherche aurait dû être annulée: %v", err)
+	}
+	t.Log("La recherche a été annulée")
+
+	if _, err := data.Retrieve(context.Background(), core.NewIdFrom([]byte("absent")), hosts[len(hosts)-1]); !errors.Is(err, core.ErrNotFound) {
+		t.Fatalf("Une donnée absente aurait dû être introuvable: %v", err)
+	}
+	t.Log("Une donnée absente est introuvable")
+
+	retrievedData, found := data.FindDataContext(context.Background(), id, hosts[len(hosts)-1])
+	if !found || !slices.Equal(retrievedData, randomData) {
+		t.Fatal("La donnée n'a pas été récupérée après l'annulation")
+	}
+	t.Log("La donnée a été récupérée après l'annulation")
+}
+
+// Un data.Retriever dont les valeurs absentes échouent avec err.
+type failingRetriever struct {
+	values map[core.Id]core.Value
+	err    error
+}
+
+func (r *failingRetriever) FindValue(id core.Id) (core.Value, bool) {
+	return r.FindValueContext(context.Background(), id)
+}
+
+func (r *failingRetriever) FindValueContext(ctx context.Context, id core.Id) (core.Value, bool) {
+	value, err := r.Retrieve(ctx, id)
+	return value, err == nil
+}
+
+func (r *failingRetriever) Retrieve(ctx context.Context, id core.Id) (core.Value, error) {
+	if value, ok := r.values[id]; ok {
+		return value, nil
+	}
+	return core.Value{}, r.err
+}
+
+func TestRetrievalErrors(t *testing.T) {
+	randomData := make([]byte, randomDataSize)
+	if _, err := rand.Read(randomData[:]); err != nil {
+		t.Fatalf("Erreur lors de la création de la donnée de test: %v", err)
+	}
+
+	id, values := data.Split(randomData)
+
+	// Tous les noeuds de l'arbre sont disponibles, sauf une feuille.
+	newRetriever := func(err error) *failingRetriever {
+		r := &failingRetriever{values: make(map[core.Id]core.Value), err: err}
+		for _, value := range values {
+			r.values[core.NewIdFrom(value[:])] = value
+		}
+		for valueId, value := range r.values {
+			if value[0] == 1 {
+				delete(r.values, valueId)
+				break
+			}
+		}
+		return r
+	}
+
+	_, err := data.Retrieve(context.Background(), id, newRetriever(core.ErrNotFound))
+	var partial *data.PartialTreeError
+	if !errors.As(err, &partial) || len(partial.Missing) != 1 {
+		t.Fatalf("Un noeud introuvable aurait dû être signalé comme manquant: %v", err)
+	}
+	t.Log("Un noeud introuvable est signalé comme manquant")
+
+	for _, want := range []error{core.ErrNoPeers, core.ErrTimeout} {
+		_, err := data.Retrieve(context.Background(), id, newRetriever(want))
+		if !errors.Is(err, want) || errors.Is(err, data.ErrPartialTree) {
+			t.Fatalf("L'erreur %v aurait dû être retournée plutôt qu'un arbre partiel: %v", want, err)
+		}
+	}
+	t.Log("Les autres erreurs sont retournées telles quelles")
+}
+
+func TestInvalidConfig(t *testing.T) {
+	configs := map[string]func(*core.Config){
+		"MaxReplicasCount nul":   func(c *core.Config) { c.MaxReplicasCount = 0 },
+		"BucketCapacity négatif": func(c *core.Config) { c.BucketCapacity = -1 },
+		"TransferRate nul":       func(c *core.Config) { c.TransferRate = 0 },
+		"TransferRate excessif":  func(c *core.Config) { c.TransferRate = int(time.Second) + 1 },
+	}
+
+	for name, invalidate := range configs {
+		config := core.DefaultConfig()
+		invalidate(&config)
+
+		host := core.NewHost(
+			"node-a",
+			core.NewMemoryStorage(),
+			core.WithTransport(core.NewMemoryTransport()),
+			core.WithConfig(config),
+		)
+
+		err := host.Start()
+		if err == nil {
+			host.Stop()
+		}
+
+		if !errors.Is(err, core.ErrInvalidConfig) {
+			t.Fatalf("La configuration invalide (%s) aurait dû être refusée: %v", name, err)
+		}
+
+		if err := host.Bootstrap("node-b"); !errors.Is(err, core.ErrInvalidConfig) {
+			t.Fatalf("Le noeud mal configuré (%s) n'aurait pas dû envoyer de requête: %v", name, err)
+		}
+
+		t.Logf("La configuration invalide (%s) a été refusée: %v", name, err)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	hosts := newNetwork(t, smallNodeCount)
+	defer destroyNetwork(hosts)
+
+	subs := make([]*core.Subscription, len(hosts))
+	for i, host := range hosts {
+		subs[i] = host.Subscribe(core.ValueStoredEvent)
+		defer subs[i].Close()
+	}
+
+	lookups := hosts[0].Subscribe(core.LookupCompletedEvent)
+	defer lookups.Close()
+
+	id, _ := hosts[0].StoreValue(core.Value{1})
+
+	stored := 0
+	for _, sub := range subs {
+	drain:
+		for {
+			select {
+			case e := <-sub.Events():
+				if e.Type != core.ValueStoredEvent {
+					t.Fatalf("Événement inattendu: %s", e.Type)
+				}
+				if e.Id.Equal(id) {
+					stored++
+				}
+			default:
+				break drain
+			}
+		}
+	}
+
+	if stored == 0 {
+		t.Fatal("Aucun événement de stockage n'a été reçu")
+	}
+	t.Logf("%d événements de stockage reçus", stored)
+
+	select {
+	case e := <-lookups.Events():
+		if e.Type != core.LookupCompletedEvent || len(e.Peers) == 0 {
+			t.Fatal("L'événement de fin de recherche est incorrect")
+		}
+	default:
+		t.Fatal("Aucun événement de fin de recherche n'a été reçu")
+	}
+	t.Log("L'événement de fin de recherche a été reçu")
+}
+
+func TestMetrics(t *testing.T) {
+	hosts := newNetwork(t, smallNodeCount)
+	defer destroyNetwork(hosts)
+
+	store(t, hosts, 0, []byte("metrics"))
+
+	var buf bytes.Buffer
+	if err := hosts[0].WriteMetrics(&buf); err != nil {
+		t.Fatalf("Erreur lors de l'écriture des métriques: %v", err)
+	}
+
+	for _, sample := range []string{
+		`gdfs_rpc_requests_total{type="store",outcome="ok"}`,
+		`gdfs_lookup_hops_bucket{found="false",le="+Inf"}`,
+		`gdfs_transport_bytes_total{direction="out"}`,
+		`gdfs_routing_peers `,
+		`gdfs_rpc_queue_depth{priority="low"}`,
+	} {
+		if !strings.Contains(buf.String(), sample) {
+			t.Fatalf("Métrique absente: %s", sample)
+		}
+	}
+	t.Log("Les métriques ont été écrites")
+}
+
+func TestLogging(t *testing.T) {
+	transport := core.NewMemoryTransport()
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	a := core.NewHost("node-a", core.NewMemoryStorage(), core.WithTransport(transport))
+	b := core.NewHost(
+		"node-b",
+		core.NewMemoryStorage(),
+		core.WithTransport(transport),
+		core.WithLogger(logger),
+		core.WithLogLevel(core.RpcComponent, slog.LevelWarn),
+	)
+
+	hosts := []*core.Host{a, b}
+	for _, host := range hosts {
+		if err := host.Start(); err != nil {
+			t.Fatalf("Erreur lors du démarrage du noeud: %v", err)
+		}
+	}
+
+	err := b.Bootstrap(a.Addr())
+	destroyNetwork(hosts)
+	if err != nil {
+		t.Fatalf("Erreur lors du bootstrap: %v", err)
+	}
+
+	if !strings.Contains(logs.String(), `"msg":"peer added","component":"routing"`) {
+		t.Fatal("L'ajout du noeud n'a pas été journalisé")
+	}
+	if strings.Contains(logs.String(), `"component":"rpc"`) {
+		t.Fatal("Les requêtes auraient dû être ignorées sous le niveau du composant")
+	}
+	t.Log("Les composants sont journalisés selon leur niveau")
+}
+
+func TestBusyPeer(t *testing.T) {
+	transport := core.NewMemoryTransport()
+
+	config := core.DefaultConfig()
+	config.PeerStoreLimit = core.RateLimit{Rate: 0.001, Burst: 1}
+
+	a := core.NewHost("node-a", core.NewMemoryStorage(), core.WithTransport(transport))
+	b := core.NewHost("node-b", core.NewMemoryStorage(), core.WithTransport(transport), core.WithConfig(config))
+
+	hosts := []*core.Host{a, b}
+	defer destroyNetwork(hosts)
+	for _, host := range hosts {
+		if err := host.Start(); err != nil {
+			t.Fatalf("Erreur lors du démarrage du noeud: %v", err)
+		}
+	}
+
+	if err := a.Bootstrap(b.Addr()); err != nil {
+		t.Fatalf("Erreur lors du bootstrap: %v", err)
+	}
+
+	a.StoreValue(core.Value{1})
+	a.StoreValue(core.Value{2})
+
+	var buf bytes.Buffer
+	a.WriteMetrics(&buf)
+	if !strings.Contains(buf.String(), `gdfs_rpc_requests_total{type="store",outcome="busy"}`) {
+		t.Fatal("Le second stockage aurait dû être refusé")
+	}
+	if a.KnownPeerCount() != 1 {
+		t.Fatal("Le noeud surchargé n'aurait pas dû être retiré de la table de routage")
+	}
+
+	buf.Reset()
+	b.WriteMetrics(&buf)
+	if !strings.Contains(buf.String(), `gdfs_rpc_rejected_total{reason="peer",type="store"} 1`) {
+		t.Fatal("Le refus du stockage n'a pas été compté")
+	}
+	t.Log("Le noeud surchargé a répondu busy et est resté dans la table de routage")
+}
+
+func TestLeave(t *testing.T) {
+	transport := core.NewMemoryTransport()
+	storage := core.NewMemoryStorage()
+	leaving := core.NewHost("node-leaving", storage, core.WithTransport(transport))
+
+	hosts := make([]*core.Host, smallNodeCount)
+	for i := range hosts {
+		hosts[i] = core.NewHost(fmt.Sprintf("node-%d", i), core.NewMemoryStorage(), core.WithTransport(transport))
+	}
+	defer destroyNetwork(hosts)
+
+	for i, host := range append([]*core.Host{leaving}, hosts...) {
+		if err := host.Start(); err != nil {
+			t.Fatalf("Erreur lors du démarrage du noeud: %v", err)
+		}
+		if i > 0 {
+			if err := host.Bootstrap(leaving.Addr()); err != nil {
+				t.Fatalf("Erreur lors du bootstrap: %v", err)
+			}
+		}
+	}
+
+	subs := make([]*core.Subscription, len(hosts))
+	for i, host := range hosts {
+		subs[i] = host.Subscribe(core.PeerRemovedEvent, core.PeerReplacedEvent)
+		defer subs[i].Close()
+	}
+
+	// La valeur n'est détenue que par le noeud qui part.
+	value := core.Value{42}
+	id := core.NewIdFrom(value[:])
+	storage.Set(id, value)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := leaving.Leave(ctx); err != nil {
+		t.Fatalf("Erreur lors du départ du noeud: %v", err)
+	}
+
+	removed := 0
+	for _, sub := range subs {
+	drain:
+		for {
+			select {
+			case e := <-sub.Events():
+				if e.Peer.Id.Equal(leaving.Id()) || e.Replaced.Id.Equal(leaving.Id()) {
+					removed++
+				}
+			default:
+				break drain
+			}
+		}
+	}
+
+	if removed == 0 {
+		t.Fatal("Aucun noeud n'a retiré le noeud parti de sa table de routage")
+	}
+	t.Logf("%d noeuds ont retiré le noeud parti de leur table de routage", removed)
+
+	if _, err := hosts[len(hosts)-1].Retrieve(ctx, id); err != nil {
+		t.Fatalf("La valeur du noeud parti n'a pas été retrouvée: %v", err)
+	}
+	t.Log("La valeur du noeud parti a été retrouvée")
+}
+
+// Un stockage dont les valeurs ne sont jamais transmises aux nouveaux
+// noeuds, Keys ne les listant pas.
+type unlistedStorage struct {
+	*core.MemoryStorage
+}
+
+func (unlistedStorage) Keys() map[core.Id]time.Time {
+	return map[core.Id]time.Time{}
+}
+
+func TestLeaveSkipsHolders(t *testing.T) {
+	transport := core.NewMemoryTransport()
+	storage := core.NewMemoryStorage()
+	leaving := core.NewHost("node-leaving", storage, core.WithTransport(transport))
+
+	hosts := make([]*core.Host, 3)
+	storages := make([]*core.MemoryStorage, len(hosts))
+	for i := range hosts {
+		storages[i] = core.NewMemoryStorage()
+		hosts[i] = core.NewHost(fmt.Sprintf("node-%d", i), unlistedStorage{storages[i]}, core.WithTransport(transport))
+	}
+	defer destroyNetwork(hosts)
+
+	// La valeur, détenue par tous les noeuds, est plus proche du noeud
+	// qui part que des autres : les transmissions déclenchées par
+	// l'arrivée des noeuds ne la concernent pas, seul le départ pourrait
+	// la stocker.
+	var value core.Value
+	var id core.Id
+	for i := 0; ; i++ {
+		value = core.Value{byte(i), byte(i >> 8)}
+		id = core.NewIdFrom(value[:])
+		if !slices.ContainsFunc(hosts, func(host *core.Host) bool {
+			return host.Id().Distance(id).Less(leaving.Id().Distance(id))
+		}) {
+			break
+		}
+	}
+
+	storage.Set(id, value)
+
+	subs := make([]*core.Subscription, len(hosts))
+	for i, host := range hosts {
+		storages[i].Set(id, value)
+		subs[i] = host.Subscribe(core.ValueStoredEvent)
+		defer subs[i].Close()
+	}
+
+	if err := leaving.Start(); err != nil {
+		t.Fatalf("Erreur lors du démarrage du noeud: %v", err)
+	}
+	for _, host := range hosts {
+		if err := host.Start(); err != nil {
+			t.Fatalf("Erreur lors du démarrage du noeud: %v", err)
+		}
+		if err := host.Bootstrap(leaving.Addr()); err != nil {
+			t.Fatalf("Erreur lors du bootstrap: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := leaving.Leave(ctx); err != nil {
+		t.Fatalf("Erreur lors du départ du noeud: %v", err)
+	}
+
+	for i, sub := range subs {
+		select {
+		case e := <-sub.Events():
+			t.Fatalf("Le noeud %d détenait déjà la valeur %s et n'aurait pas dû la recevoir", i, e.Id)
+		default:
+		}
+	}
+	t.Log("Aucune valeur n'a été transmise aux noeuds la détenant déjà")
+}
+
+func TestRestart(t *testing.T) {
+	transport := core.NewMemoryTransport()
+	a := core.NewHost("node-a", core.NewMemoryStorage(), core.WithTransport(transport))
+	b := core.NewHost("node-b", core.NewMemoryStorage(), core.WithTransport(transport))
+
+	if err := a.Start(); err != nil {
+		t.Fatalf("Erreur lors du démarrage du noeud: %v", err)
+	}
+	defer a.Stop()
+
+	for i := range 2 {
+		ctx, cancel := context.WithCancel(context.Background())
+		stopped := make(chan error, 1)
+		go func() {
+			stopped <- b.Run(ctx)
+		}()
+
+		select {
+		case <-b.Ready():
+		case err := <-stopped:
+			t.Fatalf("Erreur lors du démarrage %d du noeud: %v", i+1, err)
+		}
+
+		if err := b.Start(); !errors.Is(err, core.ErrHostRunning) {
+			t.Fatalf("Le noeud démarré n'aurait pas dû redémarrer: %v", err)
+		}
+
+		if err := b.Bootstrap(a.Addr()); err != nil {
+			t.Fatalf("Erreur lors du bootstrap après le démarrage %d: %v", i+1, err)
+		}
+
+		cancel()
+		if err := <-stopped; err != nil {
+			t.Fatalf("Erreur à l'arrêt du noeud: %v", err)
+		}
+	}
+	t.Log("Le noeud a été démarré, arrêté puis redémarré")
+}
+
+func TestRepublish(t *testing.T) {
+	transport := core.NewMemoryTransport()
+
+	config := core.DefaultConfig()
+	config.StorageTtl = time.Second
+	config.ReplicateFreq = 900 * time.Millisecond
+	config.RepublishFreq = 200 * time.Millisecond
+	config.PublishedTtl = 2 * time.Second
+
+	// Le noeud qui publie ne stocke rien, la valeur n'est détenue que
+	// par l'autre noeud et expire sans republication.
+	storage := core.NewMemoryStorageWithConfig(config)
+	publisher := core.NewHost("node-a", core.NewFakeStorage(), core.WithTransport(transport), core.WithConfig(config))
+	holder := core.NewHost("node-b", storage, core.WithTransport(transport), core.WithConfig(config))
+
+	hosts := []*core.Host{publisher, holder}
+	defer destroyNetwork(hosts)
+	for _, host := range hosts {
+		if err := host.Start(); err != nil {
+			t.Fatalf("Erreur lors du démarrage du noeud: %v", err)
+		}
+	}
+
+	if err := publisher.Bootstrap(holder.Addr()); err != nil {
+		t.Fatalf("Erreur lors du bootstrap: %v", err)
+	}
+
+	stored := holder.Subscribe(core.ValueStoredEvent)
+	defer stored.Close()
+
+	id, replicas := publisher.StoreValue(core.Value{1})
+	if replicas == 0 {
+		t.Fatal("La valeur n'a pas été stockée")
+	}
+
+	// Le premier stockage, puis une republication avant l'expiration.
+	for range 2 {
+		if !waitForEvent(stored, config.StorageTtl, func(e core.Event) bool { return e.Id.Equal(id) }) {
+			t.Fatal("La valeur publiée aurait dû être republiée avant son expiration")
+		}
+	}
+	if _, ok := storage.Get(id); !ok {
+		t.Fatal("La valeur publiée aurait dû être republiée avant son expiration")
+	}
+	t.Log("La valeur publiée a été republiée")
+
+	expired := waitFor(config.PublishedTtl+2*config.StorageTtl, func() bool {
+		_, ok := storage.Get(id)
+		return !ok
+	})
+	if !expired {
+		t.Fatal("La valeur n'aurait plus dû être republiée après PublishedTtl")
+	}
+	t.Log("La valeur n'est plus republiée après PublishedTtl")
+}
+
+func TestTransferToNewPeer(t *testing.T) {
+	transport := core.NewMemoryTransport()
+
+	storage := core.NewMemoryStorage()
+	newStorage := core.NewMemoryStorage()
+	a := core.NewHost("node-a", storage, core.WithTransport(transport))
+	b := core.NewHost("node-b", newStorage, core.WithTransport(transport))
+
+	hosts := []*core.Host{a, b}
+	defer destroyNetwork(hosts)
+	for _, host := range hosts {
+		if err := host.Start(); err != nil {
+			t.Fatalf("Erreur lors du démarrage du noeud: %v", err)
+		}
+	}
+
+	// Les valeurs dont le nouveau noeud est plus proche que le noeud qui
+	// les détient, et celles dont il est plus éloigné.
+	var closer, farther []core.Id
+	for i := range 64 {
+		value := core.Value{byte(i)}
+		id := core.NewIdFrom(value[:])
+		if b.Id().Distance(id).Less(a.Id().Distance(id)) {
+			closer = append(closer, id)
+		} else {
+			farther = append(farther, id)
+		}
+		storage.Set(id, value)
+	}
+
+	if err := b.Bootstrap(a.Addr()); err != nil {
+		t.Fatalf("Erreur lors du bootstrap: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for _, id := range closer {
+		for {
+			if _, ok := newStorage.Get(id); ok {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("Les valeurs n'ont pas été transmises au nouveau noeud plus proche")
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+	t.Logf("%d valeurs ont été transmises au nouveau noeud plus proche", len(closer))
+
+	for _, id := range farther {
+		if _, ok := newStorage.Get(id); ok {
+			t.Fatal("Une valeur plus proche du noeud local n'aurait pas dû être transmise")
+		}
+	}
+	t.Log("Les valeurs plus proches du noeud local n'ont pas été transmises")
+}
+
+func TestUnreachableAdvertisedAddr(t *testing.T) {
+	transport := core.NewMemoryTransport()
+
+	a := core.NewHost("node-a", core.NewMemoryStorage(), core.WithTransport(transport))
+	// Le noeud annonce une adresse à laquelle personne ne répond.
+	b := core.NewHost("node-b", core.NewMemoryStorage(), core.WithTransport(transport), core.WithAdvertisedAddr("node-unreachable"))
+	c := core.NewHost("node-c", core.NewMemoryStorage(), core.WithTransport(transport))
+
+	hosts := []*core.Host{a, b, c}
+	defer destroyNetwork(hosts)
+	for _, host := range hosts {
+		if err := host.Start(); err != nil {
+			t.Fatalf("Erreur lors du démarrage du noeud: %v", err)
+		}
+	}
+
+	added := a.Subscribe(core.PeerAddedEvent)
+	defer added.Close()
+
+	if err := b.Bootstrap(a.Addr()); err != nil {
+		t.Fatalf("Erreur lors du bootstrap: %v", err)
+	}
+	if err := c.Bootstrap(a.Addr()); err != nil {
+		t.Fatalf("Erreur lors du bootstrap: %v", err)
+	}
+
+	// Le noeud joignable est ajouté après avoir répondu au ping-back,
+	// l'autre ne peut jamais l'être.
+	if !waitForEvent(added, 5*time.Second, func(e core.Event) bool { return e.Peer.Id.Equal(c.Id()) }) {
+		t.Fatal("Le noeud joignable aurait dû être ajouté")
+	}
+
+	if n := a.KnownPeerCount(); n != 1 {
+		t.Fatalf("%d noeuds connus, seul le noeud joignable aurait dû être ajouté", n)
+	}
+	t.Log("Le noeud dont l'adresse annoncée ne répond pas n'a pas été ajouté")
+}
+
+func TestAddrDiscovery(t *testing.T) {
+	a := core.NewHost(fmt.Sprintf("127.0.0.1:%d", discoveryBasePort), core.NewMemoryStorage())
+	b := core.NewHost(fmt.Sprintf("0.0.0.0:%d", discoveryBasePort+1), core.NewMemoryStorage(), core.WithAddrDiscovery())
+
+	hosts := []*core.Host{a, b}
+	defer destroyNetwork(hosts)
+	for _, host := range hosts {
+		if err := host.Start(); err != nil {
+			t.Fatalf("Erreur lors du démarrage du noeud: %v", err)
+		}
+	}
+
+	added := a.Subscribe(core.PeerAddedEvent)
+	defer added.Close()
+
+	if err := b.Bootstrap(a.Addr()); err != nil {
+		t.Fatalf("Erreur lors du bootstrap: %v", err)
+	}
+
+	advertised := fmt.Sprintf("127.0.0.1:%d", discoveryBasePort+1)
+	if b.Addr() != advertised || b.ListenAddr() != fmt.Sprintf("0.0.0.0:%d", discoveryBasePort+1) {
+		t.Fatalf("Le noeud annonce %s et écoute sur %s, il aurait dû annoncer %s", b.Addr(), b.ListenAddr(), advertised)
+	}
+	t.Logf("Le noeud écoute sur %s et annonce %s", b.ListenAddr(), b.Addr())
+
+	// Le noeud est ajouté une fois que le ping-back vers l'adresse
+	// annoncée a abouti.
+	waitForEvent(added, 5*time.Second, func(e core.Event) bool { return e.Peer.Id.Equal(b.Id()) })
+
+	if a.KnownPeerCount() != 1 {
+		t.Fatal("Le noeud aurait dû être joignable à l'adresse qu'il annonce")
+	}
+	t.Log("Le noeud a été ajouté à l'adresse qu'il annonce")
+}
+
+func TestTimeoutErrors(t *testing.T) {
+	transport := core.NewMemoryTransport()
+
+	config := core.DefaultConfig()
+	config.ConnTtl = 200 * time.Millisecond
+
+	a := core.NewHost("node-a", core.NewMemoryStorage(), core.WithTransport(transport), core.WithConfig(config))
+	b := core.NewHost("node-b", core.NewMemoryStorage(), core.WithTransport(transport))
+
+	hosts := []*core.Host{a, b}
+	defer destroyNetwork(hosts)
+	for _, host := range hosts {
+		if err := host.Start(); err != nil {
+			t.Fatalf("Erreur lors du démarrage du noeud: %v", err)
+		}
+	}
+
+	if err := a.Bootstrap(b.Addr()); err != nil {
+		t.Fatalf("Erreur lors du bootstrap: %v", err)
+	}
+
+	// Le seul noeud connu est remplacé par un noeud qui accepte les
+	// connexions sans jamais répondre.
+	b.Stop()
+	listener, err := transport.Listen(b.Addr())
+	if err != nil {
+		t.Fatalf("Erreur lors de l'écoute: %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	// Laisse le temps au noeud de constater la fermeture de sa connexion
+	// vers l'ancien noeud.
+	time.Sleep(100 * time.Millisecond)
+
+	ctx := context.Background()
+
+	if _, err := a.Retrieve(ctx, core.NewRandomId()); !errors.Is(err, core.ErrTimeout) || !errors.Is(err, core.ErrNoPeers) {
+		t.Fatalf("La recherche aurait dû échouer faute de réponse dans les délais: %v", err)
+	}
+	t.Log("La recherche a échoué faute de réponse dans les délais")
+
+	if _, _, err := a.Publish(ctx, core.Value{1}); !errors.Is(err, core.ErrTimeout) {
+		t.Fatalf("Le stockage aurait dû échouer faute de réponse dans les délais: %v", err)
+	}
+	t.Log("Le stockage a échoué faute de réponse dans les délais")
+}
@@ -9,27 +9,62 @@ import (
 	"github.com/mattesthaut/gdfs/data"
 )
 
+// Ports d'écoute des réseaux TCP, en dehors de la plage des ports
+// éphémères pour qu'une connexion sortante ne les occupe pas.
 const (
-	basePort = 42000
+	basePort          = 22000
+	mixedBasePort     = 22100
+	discoveryBasePort = 22200
 )
 
+// Crée un réseau de noeuds reliés par un transport en mémoire.
 func newNetwork(t *testing.T, size int) []*core.Host {
+	transport := core.NewMemoryTransport()
+	transportOf := func(int) core.Transport {
+		return transport
+	}
+	addrOf := func(i int) string {
+		return fmt.Sprintf("node-%d", i)
+	}
+
+	return startNetwork(t, size, transportOf, addrOf)
+}
+
+// Crée un réseau de noeuds écoutant sur des ports successifs à partir
+// de port. Un noeud sur udpRatio utilise UDP pour les requêtes légères,
+// les autres uniquement TCP. Si udpRatio est nul, aucun noeud n'utilise UDP.
+func newTCPNetwork(t *testing.T, size int, port int, udpRatio int) []*core.Host {
+	transportOf := func(i int) core.Transport {
+		if udpRatio > 0 && i%udpRatio == 0 {
+			return core.NewUDPTransport()
+		}
+		return core.NewTCPTransport()
+	}
+	addrOf := func(i int) string {
+		return fmt.Sprintf("127.0.0.1:%d", port+i)
+	}
+
+	hosts := startNetwork(t, size, transportOf, addrOf)
+
+	t.Log("Attente de stabilisation des tables de routage")
+	time.Sleep(time.Second)
+
+	return hosts
+}
+
+func startNetwork(t *testing.T, size int, transportOf func(int) core.Transport, addrOf func(int) string) []*core.Host {
 	t.Log("Création d'un réseau de", size, "noeuds")
 	hosts := make([]*core.Host, size)
 
 	for i := range size {
-		addr := fmt.Sprintf("127.0.0.1:%d", basePort+i)
 		storage := core.NewMemoryStorage()
-		hosts[i] = core.NewHost(addr, storage)
+		hosts[i] = core.NewHost(addrOf(i), storage, core.WithTransport(transportOf(i)))
 
 		if err := hosts[i].Start(); err != nil {
 			t.Fatalf("Erreur lors du démarrage du noeud %d: %v", i, err)
 		}
-
 	}
 
-	time.Sleep(50 * time.Millisecond)
-
 	t.Log("Phase de bootstrap des noeuds")
 	for i, host := range hosts {
 		connectedCount := 0
@@ -46,9 +81,6 @@ func newNetwork(t *testing.T, size int) []*core.Host {
 		}
 	}
 
-	t.Log("Attente de stabilisation des tables de routage")
-	time.Sleep(time.Second)
-
 	return hosts
 }
 
@@ -68,9 +100,6 @@ func networkFailure(t *testing.T, hosts []*core.Host, ratio int) {
 		disconnectedCount++
 	}
 	t.Logf("Nombre de noeuds déconnectés: %d", disconnectedCount)
-
-	t.Log("Attente de mise à jour des tables de routage")
-	time.Sleep(3 * time.Second)
 }
 
 func networkStats(t *testing.T, hosts []*core.Host) {
@@ -133,3 +162,35 @@ func store(t *testing.T, hosts []*core.Host, i int, d []byte) core.Id {
 
 	return id
 }
+
+// Attend que cond soit vraie, en la vérifiant régulièrement pendant au
+// plus timeout. Retourne false si le délai est dépassé.
+func waitFor(timeout time.Duration, cond func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
+
+// Attend un événement de sub vérifiant match pendant au plus timeout.
+// Les autres événements sont ignorés. Retourne false si le délai est
+// dépassé.
+func waitForEvent(sub *core.Subscription, timeout time.Duration, match func(core.Event) bool) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case e := <-sub.Events():
+			if match(e) {
+				return true
+			}
+		case <-timer.C:
+			return false
+		}
+	}
+}